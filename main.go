@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/adriwankenobi/comic/service"
+	"github.com/adriwankenobi/comic/web"
 	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -13,44 +22,157 @@ func main() {
 	// TODO: Custom usages for each flag
 	generate := flag.Bool("generate", false, "Generate JSON files from XLSX file")
 	update := flag.Bool("update", false, "Update XLSX file with some info from MARVEL API")
+	roles := flag.Bool("roles", false, "Fetch creators again when updating, for rows whose creators have no role")
 	folders := flag.Bool("folders", false, "Create folders structure")
+	serve := flag.Bool("serve", false, "Start web server")
+	export := flag.Bool("export", false, "Export reading order as CSV, Markdown or printable HTML")
+	name := flag.String("name", "{code}", "Name for new folders, from {code}, {title} and {year}, starting with {code}")
+	reconcile := flag.String("reconcile", "", "Fix folders not matching the XLSX: rename, flag or archive, never deletes")
+	dryRun := flag.Bool("dryrun", false, "Show folders to create and rename, or files to write, without touching them")
+	recovery := flag.Bool("recover", false, "Undo an interrupted -folders run from its journal")
+	comicInfo := flag.Bool("comicinfo", false, "Write ComicInfo.xml into CBZ files in the folders structure")
+	publisher := flag.String("publisher", "", "Publisher written into ComicInfo.xml, left out if empty")
+	scan := flag.Bool("scan", false, "Match comic files in the folders structure to XLSX rows")
+	lint := flag.Bool("lint", false, "Check reading order of the XLSX file, or of generated JSON files if there is none")
+	months := flag.Int("months", service.DefaultLintMonths, "Months a date can go backwards in reading order before -lint flags it")
 	f := flag.String("f", "", "XSLX file to read")
 	o := flag.String("o", "", "Path to output")
 	start := flag.Int("start", -1, "Start year to find comics")
 	end := flag.Int("end", -1, "End year to find comics")
 	mPubKey := flag.String("mpubkey", "", "MARVEL API public key")
 	mPriKey := flag.String("mprikey", "", "MARVEL API private key")
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	data := flag.String("data", "web/data", "Path to generated JSON files")
+	html := flag.String("html", "web/html", "Path to HTML files")
+	static := flag.String("static", "web/static", "Path to static files")
+	adminToken := flag.String("admintoken", "", "Token for POST /admin/reload and for progress and list writes, those open to anyone if empty")
+	watch := flag.Duration("watch", 0, "Reload data when it changes, checking every interval (e.g. 10s)")
+	progress := flag.String("progress", "web/progress", "Path to store reading progress, disabled if empty")
+	lists := flag.String("lists", "web/lists", "Path to store custom reading lists, disabled if empty")
+	exportType := flag.String("type", "comics", "What to export: phases, events, characters, creators or comics")
+	id := flag.String("id", "", "Code of the phase, event, character or creator to export")
+	format := flag.String("format", "csv", "Export format: csv, markdown or html")
+	move := flag.Bool("move", false, "Move matched comic files into their phase and sortid folder when scanning")
+	report := flag.String("report", "", "JSON file to write the scan, folders or lint report to")
+	catalogsFile := flag.String("catalogs", "", "JSON file with the catalogues to use instead of -f and -data, the first one served at '/'")
+	catalog := flag.String("catalog", "", "Only this catalogue from -catalogs")
 	flag.Parse()
 
 	var err error
 	var errFlag error
+	problems := 0
 
-	if *generate {
-		out, errFlag := validateGenerateFlags(*f, *o)
+	// Each catalogue has its own XLSX, metadata provider and data folder
+	catalogs := service.Catalogs{}
+	if *catalog != "" && *catalogsFile == "" {
+		fmt.Println("Catalogues file cannot be empty with a catalogue")
+		return
+	}
+	if *catalogsFile != "" {
+		catalogs, err = readCatalogs(*catalogsFile, *catalog)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}
+
+	// Commands working on one XLSX or data folder take them from the catalogue
+	if len(catalogs) > 0 && (*folders || *export || *scan || *comicInfo) {
+		var c service.Catalog
+		c, err = catalogs.One()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		*f, *data = c.Workbook, c.Data
+		if *publisher == "" {
+			*publisher = c.Publisher
+		}
+	}
+
+	if *generate && len(catalogs) > 0 {
+		err = generateCatalogs(catalogs)
+	} else if *generate {
+		var out string
+		out, errFlag = validateGenerateFlags(*f, *o)
 		if errFlag == nil {
 			fmt.Printf("Generating from '%s' to '%s'\n", *f, out)
 			err = generateJSON(*f, out)
 		}
 	}
 
-	if *update {
+	if *update && len(catalogs) > 0 {
+		err = updateCatalogs(catalogs, *start, *end, *mPubKey, *mPriKey, *roles)
+	} else if *update {
 		errFlag = validateUpdateFlags(*f, *start, *end, *mPubKey, *mPriKey)
 		if errFlag == nil {
 			fmt.Printf("Updating '%s'\n", *f)
-			err = updateXLS(*f, *start, *end, *mPubKey, *mPriKey)
+			err = updateXLS(*f, *start, *end, *mPubKey, *mPriKey, *roles)
 		}
 	}
 
 	if *folders {
-		out, errFlag := validateFoldersFlags(*f, *o)
-		if errFlag == nil {
+		var out string
+		out, errFlag = validateFoldersFlags(*f, *o, *recovery)
+		if errFlag == nil && *recovery {
+			fmt.Printf("Recovering folders in '%s'\n", out)
+			err = recoverFolders(out)
+		} else if errFlag == nil {
 			fmt.Printf("Creating folders from '%s' in '%s\n", *f, out)
-			err = createFolders(*f, out)
+			opts := service.FolderOptions{Template: *name, Reconcile: *reconcile, DryRun: *dryRun}
+			err = createFolders(*f, out, opts, *report)
+		}
+	}
+
+	if *serve {
+		errFlag = validateServeFlags(*addr, *data, *html, *static)
+		if errFlag == nil && len(catalogs) == 0 {
+			catalogs = service.Catalogs{{Data: *data}}
+		}
+		if errFlag == nil {
+			for _, c := range catalogs {
+				fmt.Printf("Serving '%s' on '%s'\n", c.Data, *addr)
+			}
+			err = startServer(*addr, catalogs, *html, *static, *adminToken, *watch, *progress, *lists)
+		}
+	}
+
+	if *export {
+		errFlag = validateExportFlags(*data, *exportType, *id, *format)
+		if errFlag == nil {
+			err = exportReadingOrder(*data, *exportType, *id, *format, *o)
 		}
 	}
 
-	if !*generate && !*update && !*folders {
-		errFlag = errors.New("One these flags is mandatory: [-generate, -update, -folders]")
+	if *scan {
+		var out string
+		out, errFlag = validateScanFlags(*f, *o)
+		if errFlag == nil {
+			fmt.Printf("Scanning '%s' with '%s'\n", out, *f)
+			err = scanLibrary(*f, out, *move, *report)
+		}
+	}
+
+	if *comicInfo {
+		var out string
+		out, errFlag = validateComicInfoFlags(*data, *o)
+		if errFlag == nil {
+			fmt.Printf("Writing ComicInfo.xml from '%s' in '%s'\n", *data, out)
+			err = writeComicInfo(*data, out, *publisher, *dryRun)
+		}
+	}
+
+	if *lint && len(catalogs) > 0 {
+		problems, err = lintCatalogs(catalogs, *months, *report)
+	} else if *lint {
+		errFlag = validateLintFlags(*f, *data, *months)
+		if errFlag == nil {
+			problems, err = lintReadingOrder(*f, *data, *months, *report)
+		}
+	}
+
+	if !*generate && !*update && !*folders && !*serve && !*export && !*scan && !*comicInfo && !*lint {
+		errFlag = errors.New("One these flags is mandatory: [-generate, -update, -folders, -serve, -export, -scan, -comicinfo, -lint]")
 	}
 
 	if errFlag != nil {
@@ -62,6 +184,11 @@ func main() {
 		fmt.Println(err.Error())
 	}
 
+	// Fail CI builds, also when the check could not run
+	if problems > 0 || err != nil {
+		os.Exit(1)
+	}
+
 }
 
 func validateGenerateFlags(f, o string) (string, error) {
@@ -98,6 +225,31 @@ func generateJSON(f, out string) error {
 	return nil
 }
 
+// Catalogues from the file, only the named one if any
+func readCatalogs(f, name string) (service.Catalogs, error) {
+	catalogs, err := service.ReadCatalogs(f)
+	if err != nil {
+		return nil, err
+	}
+	return catalogs.Select(name)
+}
+
+func generateCatalogs(catalogs service.Catalogs) error {
+	for _, c := range catalogs {
+		out := strings.TrimSuffix(c.Data, "/")
+		fmt.Printf("Generating '%s' from '%s' to '%s'\n", c.Name, c.Workbook, out)
+		err := os.MkdirAll(out, 0755)
+		if err != nil {
+			return err
+		}
+		err = generateJSON(c.Workbook, out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func validateUpdateFlags(f string, start, end int, mPubKey, mPriKey string) error {
 	if f == "" || start == -1 || end == -1 || mPubKey == "" || mPriKey == "" {
 		return errors.New("Input file, start and end cannot be empty\nMARVEL public and private keys are needed")
@@ -105,10 +257,10 @@ func validateUpdateFlags(f string, start, end int, mPubKey, mPriKey string) erro
 	return nil
 }
 
-func updateXLS(f string, start, end int, mPubKey, mPriKey string) error {
+func updateXLS(f string, start, end int, mPubKey, mPriKey string, roles bool) error {
 
 	// Update XLS file
-	err := service.UpdateXLSX(f, start, end, mPubKey, mPriKey)
+	err := service.UpdateXLSX(f, start, end, mPubKey, mPriKey, roles)
 	if err != nil {
 		return err
 	}
@@ -117,8 +269,29 @@ func updateXLS(f string, start, end int, mPubKey, mPriKey string) error {
 	return nil
 }
 
-func validateFoldersFlags(f, o string) (string, error) {
-	if f == "" || o == "" {
+// Only catalogues with a metadata provider are updated
+func updateCatalogs(catalogs service.Catalogs, start, end int, mPubKey, mPriKey string, roles bool) error {
+	for _, c := range catalogs {
+		switch c.Provider {
+		case service.ProviderMarvel:
+			err := validateUpdateFlags(c.Workbook, start, end, mPubKey, mPriKey)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Updating '%s' from '%s'\n", c.Workbook, c.Provider)
+			err = updateXLS(c.Workbook, start, end, mPubKey, mPriKey, roles)
+			if err != nil {
+				return err
+			}
+		default:
+			fmt.Printf("Skipping '%s', it has no metadata provider\n", c.Name)
+		}
+	}
+	return nil
+}
+
+func validateFoldersFlags(f, o string, recovery bool) (string, error) {
+	if o == "" || (f == "" && !recovery) {
 		return "", errors.New("Input file and output path cannot be empty")
 	}
 	out := o
@@ -128,10 +301,269 @@ func validateFoldersFlags(f, o string) (string, error) {
 	return out, nil
 }
 
-func createFolders(f, o string) error {
+func createFolders(f, o string, opts service.FolderOptions, report string) error {
 
 	// Create folders structure
-	err := service.CreateFolders(f, o)
+	r, err := service.CreateFolders(f, o, opts)
+	if err != nil {
+		return err
+	}
+
+	if report != "" {
+		json, err := r.ToJson()
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(report, json, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Done!")
+	return nil
+}
+
+func recoverFolders(o string) error {
+
+	// Undo interrupted run
+	err := service.RecoverFolders(o)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Done!")
+	return nil
+}
+
+func validateScanFlags(f, o string) (string, error) {
+	if f == "" || o == "" {
+		return "", errors.New("Input file and library path cannot be empty")
+	}
+	out := o
+	if string(o[len(o)-1]) == "/" {
+		out = o[:len(o)-1]
+	}
+	return out, nil
+}
+
+func scanLibrary(f, o string, move bool, report string) error {
+
+	// Match files to XLSX rows
+	r, err := service.ScanLibrary(f, o, move)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range r.Owned {
+		fmt.Printf("[Owned] %s - %s: %s (%s)\n", m.Issue.PhaseID, m.Issue.SortID, m.Issue, m.File.Path)
+	}
+	for _, i := range r.Missing {
+		fmt.Printf("[Missing] %s - %s: %s\n", i.PhaseID, i.SortID, i)
+	}
+	for _, file := range r.Unmatched {
+		fmt.Printf("[Unmatched] %s\n", file.Path)
+	}
+	fmt.Printf("%v files owned, %v issues missing, %v files unmatched\n", len(r.Owned), len(r.Missing), len(r.Unmatched))
+
+	if report != "" {
+		json, err := r.ToJson()
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(report, json, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Done!")
+	return nil
+}
+
+func validateComicInfoFlags(data, o string) (string, error) {
+	if data == "" || o == "" {
+		return "", errors.New("Data path and library path cannot be empty")
+	}
+	out := o
+	if string(o[len(o)-1]) == "/" {
+		out = o[:len(o)-1]
+	}
+	return out, nil
+}
+
+func writeComicInfo(data, o, publisher string, dryRun bool) error {
+
+	// Write metadata into CBZ files
+	err := service.WriteComicInfo(data, o, publisher, dryRun)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Done!")
+	return nil
+}
+
+func validateLintFlags(f, data string, months int) error {
+	if f == "" && data == "" {
+		return errors.New("Input file or data path cannot be empty")
+	}
+	if months <= 0 {
+		return errors.New("Months must be greater than 0")
+	}
+	return nil
+}
+
+// Number of problems found
+func lintReadingOrder(f, data string, months int, report string) (int, error) {
+
+	// Check XLSX or JSON files
+	r, err := service.LintFile(f, data, service.LintOptions{Months: months})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range r.Problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("%v issues in '%s', %v problems found\n", r.Issues, r.Source, len(r.Problems))
+
+	if report != "" {
+		json, err := r.ToJson()
+		if err != nil {
+			return 0, err
+		}
+		err = ioutil.WriteFile(report, json, 0644)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(r.Problems), nil
+}
+
+// Problems of all catalogues, a report only for one of them
+func lintCatalogs(catalogs service.Catalogs, months int, report string) (int, error) {
+	if report != "" && len(catalogs) > 1 {
+		return 0, fmt.Errorf("Report is for one catalogue: %v catalogues, choose one with -catalog", len(catalogs))
+	}
+	problems := 0
+	for _, c := range catalogs {
+		err := validateLintFlags(c.Workbook, c.Data, months)
+		if err != nil {
+			return problems, err
+		}
+		fmt.Printf("Linting '%s'\n", c.Name)
+		n, err := lintReadingOrder(c.Workbook, c.Data, months, report)
+		problems += n
+		if err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
+
+func validateExportFlags(data, t, id, format string) error {
+	if data == "" || t == "" || format == "" {
+		return errors.New("Data path, type and format cannot be empty")
+	}
+	if t != service.ExportComics && id == "" {
+		return fmt.Errorf("Id cannot be empty when exporting %s", t)
+	}
+	return nil
+}
+
+// Writes to stdout when there is no output path
+func exportReadingOrder(data, t, id, format, o string) error {
+	if o != "" {
+		fmt.Printf("Exporting %s %s from '%s' to '%s'\n", t, id, data, o)
+	}
+
+	// Export JSON files
+	err := service.ExportFile(data, t, id, format, o)
+	if err != nil {
+		return err
+	}
+
+	if o != "" {
+		fmt.Println("Done!")
+	}
+	return nil
+}
+
+func validateServeFlags(addr, data, html, static string) error {
+	if addr == "" || data == "" || html == "" || static == "" {
+		return errors.New("Address, data, html and static paths cannot be empty")
+	}
+	return nil
+}
+
+// The first catalogue is served at '/', the others under '/c/<name>'
+// Progress and lists of the others go into a subfolder named after them
+func startServer(addr string, catalogs service.Catalogs, html, static, adminToken string, watch time.Duration, progress, lists string) error {
+	all := []web.Catalog{}
+	for i, c := range catalogs {
+		e := web.Catalog{Name: c.Name, Title: c.Title, DataFolder: c.Data}
+		sub := ""
+		if i > 0 {
+			sub = c.Name
+		}
+		if progress != "" {
+			store, err := service.NewFileProgressStore(filepath.Join(progress, sub))
+			if err != nil {
+				return err
+			}
+			e.Progress = store
+		}
+		if lists != "" {
+			store, err := service.NewFileReadingListStore(filepath.Join(lists, sub))
+			if err != nil {
+				return err
+			}
+			e.Lists = store
+		}
+		all = append(all, e)
+	}
+
+	// favicon.ico lives next to the static folder, see web/app.yaml
+	cfg := web.Config{
+		Name:          all[0].Name,
+		Title:         all[0].Title,
+		DataFolder:    all[0].DataFolder,
+		WebFolder:     html,
+		StaticFolder:  static,
+		Favicon:       filepath.Join(filepath.Dir(filepath.Clean(static)), "favicon.ico"),
+		AdminToken:    adminToken,
+		Progress:      all[0].Progress,
+		Lists:         all[0].Lists,
+		WatchInterval: watch,
+		Catalogs:      all[1:],
+	}
+	if adminToken == "" && (progress != "" || lists != "") {
+		fmt.Println("[No admin token] Anyone can write progress and lists, keep the server local")
+	}
+	handler, err := web.NewHandler(cfg)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	// Gracefull shutdown on Ctrl+C or SIGTERM
+	done := make(chan error, 1)
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+		fmt.Println("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		done <- server.Shutdown(ctx)
+	}()
+
+	err = server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		return err
+	}
+	err = <-done
 	if err != nil {
 		return err
 	}
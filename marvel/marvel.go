@@ -69,6 +69,19 @@ func (i *itemsResponse) toString() string {
 	return strings.Join(data, ", ")
 }
 
+// Role after each name, if any: 'Paul Jenkins (writer), Jae Lee (penciller)'
+func (i *itemsResponse) toStringWithRoles() string {
+	data := []string{}
+	for _, e := range i.Items {
+		if e.Role == "" {
+			data = append(data, e.Name)
+		} else {
+			data = append(data, fmt.Sprintf("%s (%s)", e.Name, e.Role))
+		}
+	}
+	return strings.Join(data, ", ")
+}
+
 type result struct {
 	ID         int               `json:"id"`
 	Dates      datesResponse     `json:"dates"`
@@ -119,7 +132,7 @@ func (m *MarvelAPI) FindByID(id string) (MarvelResponse, error) {
 	}
 	marvelResp.Date = date.Format(marvelResponseFormat)
 	marvelResp.Pic = fmt.Sprintf("%s.%s", resp.Data.Results[0].Thumbnail.Path, resp.Data.Results[0].Thumbnail.Extension)
-	marvelResp.Creators = resp.Data.Results[0].Creators.toString()
+	marvelResp.Creators = resp.Data.Results[0].Creators.toStringWithRoles()
 	marvelResp.Characters = resp.Data.Results[0].Characters.toString()
 	return marvelResp, nil
 }
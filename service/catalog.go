@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+)
+
+var catalogRegexp = regexp.MustCompile("^[a-z0-9][a-z0-9-]{0,31}$")
+
+// Metadata providers, the API the XLSX is updated from
+const ProviderMarvel = "marvel"
+
+var Providers = []string{ProviderMarvel}
+
+// Reading order of one publisher: its XLSX, where it is updated from and where its JSON files go
+// Provider is empty when nothing updates the XLSX, publisher when ComicInfo.xml goes without it
+type Catalog struct {
+	Name      string `json:"name"`
+	Title     string `json:"title"`
+	Workbook  string `json:"workbook"`
+	Provider  string `json:"provider,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	Data      string `json:"data"`
+}
+
+type Catalogs []Catalog
+
+func ValidateCatalogName(name string) error {
+	if !catalogRegexp.MatchString(name) {
+		return fmt.Errorf("Invalid catalogue '%s': must be up to 32 lowercase letters, digits or '-'", name)
+	}
+	return nil
+}
+
+func ValidateProvider(provider string) error {
+	if provider == "" {
+		return nil
+	}
+	for _, e := range Providers {
+		if e == provider {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid provider '%s': must be one of %v", provider, Providers)
+}
+
+// Catalogues file, as a JSON array, the first one being the default
+func ReadCatalogs(f string) (Catalogs, error) {
+	bytes, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read file '%s': %v", f, err)
+	}
+	l := Catalogs{}
+	err = json.Unmarshal(bytes, &l)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse file '%s': %v", f, err)
+	}
+	if len(l) == 0 {
+		return nil, fmt.Errorf("No catalogues in '%s'", f)
+	}
+	return l, l.Validate()
+}
+
+func (l Catalogs) Validate() error {
+	names := make(map[string]bool)
+	for i, c := range l {
+		err := ValidateCatalogName(c.Name)
+		if err != nil {
+			return fmt.Errorf("Catalogue %v: %v", i+1, err)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("Catalogue %v: '%s' is already used", i+1, c.Name)
+		}
+		names[c.Name] = true
+		if c.Title == "" || c.Workbook == "" || c.Data == "" {
+			return fmt.Errorf("Catalogue '%s': title, workbook and data cannot be empty", c.Name)
+		}
+		err = ValidateProvider(c.Provider)
+		if err != nil {
+			return fmt.Errorf("Catalogue '%s': %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// The only catalogue, for commands working on one XLSX or data folder
+func (l Catalogs) One() (Catalog, error) {
+	if len(l) != 1 {
+		return Catalog{}, fmt.Errorf("%v catalogues, choose one with -catalog", len(l))
+	}
+	return l[0], nil
+}
+
+// Catalogue with this name, all of them if empty
+func (l Catalogs) Select(name string) (Catalogs, error) {
+	if name == "" {
+		return l, nil
+	}
+	for _, c := range l {
+		if c.Name == name {
+			return Catalogs{c}, nil
+		}
+	}
+	return nil, fmt.Errorf("Catalogue '%s' not found", name)
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/adriwankenobi/comic/marvel"
 	"github.com/tealeg/xlsx"
-	"io/ioutil"
 	"os"
 	"os/signal"
 	"strings"
@@ -12,6 +11,9 @@ import (
 
 // JSON generator
 func JsonGenerator(path, out string) error {
+	// Nothing left from another catalogue
+	Datastore = DatastoreType{}
+
 	// New comic list
 	comics := ComicList{}
 
@@ -48,6 +50,9 @@ func JsonGenerator(path, out string) error {
 	creatsComics := map[string]*ComicList{}
 	creatID := 0
 
+	protagonistNames := map[string]string{}
+	protagonists := map[string]Namable{}
+
 	// Loop through file sheets
 	for sheet_i, sheet := range xls.Sheets {
 		p := Namable{}
@@ -64,197 +69,174 @@ func JsonGenerator(path, out string) error {
 
 		cp := ComicList{}
 
-		lastTitle := ""
-		sortID := 0
-		for _, row := range sheet.Rows[1:] {
-			id, err := row.Cells[id_col].String()
-			if err != nil {
-				return err
-			}
-			collection, err := row.Cells[collection_col].String()
-			if err != nil {
-				return err
+		rows, err := readSheet(sheet)
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			c := Comic{}
+			c.ID = r.ID
+			c.Collection = r.Collection
+			c.Vol = r.Vol
+			c.Num = r.Num
+			c.Title = r.Title
+			c.Date = r.Date
+			if r.Event != "" {
+				c.Event = r.Event
+				e, exists := eventsMap[r.Event]
+				if !exists {
+					eventID++
+					eID, err := getCode(eventID)
+					if err != nil {
+						return err
+					}
+					e = Namable{ID: eID, Name: r.Event}
+					eventsMap[r.Event] = e
+					eventsComics[eID] = &ComicList{}
+					events = append(events, e)
+				}
+				c.EventID = e.ID
 			}
-			if collection != "" {
-				vol, err := row.Cells[vol_col].Int()
-				if err != nil {
-					return err
+			charactersArray := strings.Split(r.Characters, ", ")
+			charsList := NamableList{}
+			for _, character := range charactersArray {
+				// Empty cell, no characters
+				if character == "" {
+					continue
 				}
-				num, err := row.Cells[num_col].Float()
-				if err != nil {
-					return err
+				ch, exists := charsMap[character]
+				if !exists {
+					charID++
+					cID, err := getCode(charID)
+					if err != nil {
+						return err
+					}
+					ch = Namable{ID: cID, Name: character}
+					charsMap[character] = ch
+					charsMap[cID] = ch
+					charsComics[cID] = &ComicList{}
+					chars = append(chars, ch)
 				}
-				title, err := row.Cells[title_col].String()
-				if err != nil {
-					return err
+				charsList = append(charsList, ch)
+			}
+			c.Characters = charsList
+			creatorsArray := strings.Split(r.Creators, ", ")
+			creatsList := NamableList{}
+			for _, creator := range creatorsArray {
+				creator, role := splitCreator(creator)
+				cr, exists := creatsMap[creator]
+				if !exists {
+					creatID++
+					cID, err := getCode(creatID)
+					if err != nil {
+						return err
+					}
+					cr = Namable{ID: cID, Name: creator}
+					creatsMap[creator] = cr
+					creatsMap[cID] = cr
+					creatsComics[cID] = &ComicList{}
+					creats = append(creats, cr)
 				}
-				date, err := row.Cells[date_col].String()
-				if err != nil {
-					return err
+				// Same creator with several roles is listed once
+				if i := creatsList.index(cr.ID); i >= 0 {
+					creatsList[i].Role = strings.Trim(fmt.Sprintf("%s, %s", creatsList[i].Role, role), ", ")
+					continue
 				}
-				event, err := row.Cells[event_col].String()
+				cr.Role = role
+				creatsList = append(creatsList, cr)
+			}
+			c.Creators = creatsList
+			c.Pic = r.Pic
+			c.Universe = r.Universe
+			c.Essential = r.Essential
+			if r.Comments != "" {
+				c.Comments = strings.Split(r.Comments, ", ")
+			}
+			c.PhaseID = p.ID
+			c.PhaseName = p.Name
+			if r.NewTitle {
+				sID, err := getCode(r.SortID)
 				if err != nil {
 					return err
 				}
-				characters, err := row.Cells[characters_col].String()
-				if err != nil {
-					return err
+				co := Comic{
+					Pic:        r.Pic,
+					Title:      r.Title,
+					Date:       r.Date,
+					SortID:     sID,
+					PhaseID:    p.ID,
+					Essential: c.Essential,
+					ComicList: []Comic{
+						Comic{
+							Collection: c.Collection,
+							Vol:        c.Vol,
+							Num:        c.Num,
+						},
+					},
 				}
-				creators, err := row.Cells[creators_col].String()
-				if err != nil {
-					return err
+				iPhases.List = append(iPhases.List, co)
+				if r.Event != "" {
+					co.Event = r.Event
+					*(eventsComics[c.EventID]) = append(*(eventsComics[c.EventID]), co)
 				}
-				pic, err := row.Cells[pic_col].String()
-				if err != nil {
-					return err
+				for _, ch := range c.Characters {
+					*(charsComics[ch.ID]) = append(*(charsComics[ch.ID]), co)
 				}
-				universe, err := row.Cells[universe_col].String()
-				if err != nil {
-					return err
+				for _, cr := range c.Creators {
+					*(creatsComics[cr.ID]) = append(*(creatsComics[cr.ID]), co)
 				}
-				essential, err := row.Cells[essential_col].String()
-				if err != nil {
-					return err
+			} else {
+				co := Comic{
+					Collection: c.Collection,
+					Vol:        c.Vol,
+					Num:        c.Num,
 				}
-				var comments string
-				if len(row.Cells) > mandatory_cols {
-					comments, err = row.Cells[comments_col].String()
-					if err != nil {
-						return err
-					}
-				}
-				c := Comic{}
-				c.ID = id
-				c.Collection = collection
-				c.Vol = vol
-				c.Num = num
-				c.Title = title
-				c.Date = date
-				if event != "" {
-					c.Event = event
-					e, exists := eventsMap[event]
-					if !exists {
-						eventID++
-						eID, err := getCode(eventID)
-						if err != nil {
-							return err
-						}
-						e = Namable{ID: eID, Name: event}
-						eventsMap[event] = e
-						eventsComics[eID] = &ComicList{}
-						events = append(events, e)
-					}
-					c.EventID = e.ID
-				}
-				charactersArray := strings.Split(characters, ", ")
-				charsList := NamableList{}
-				for _, character := range charactersArray {
-					ch, exists := charsMap[character]
-					if !exists {
-						charID++
-						cID, err := getCode(charID)
-						if err != nil {
-							return err
-						}
-						ch = Namable{ID: cID, Name: character}
-						charsMap[character] = ch
-						charsMap[cID] = ch
-						charsComics[cID] = &ComicList{}
-						chars = append(chars, ch)
-					}
-					charsList = append(charsList, ch)
+				last := iPhases.List[len(iPhases.List)-1]
+				last.ComicList = append(last.ComicList, co)
+				iPhases.List[len(iPhases.List)-1] = last
+				if r.Event != "" {
+					eventC := *(eventsComics[c.EventID])
+					last := eventC[len(eventC)-1]
+					last.ComicList = append(last.ComicList, co)
+					eventC[len(eventC)-1] = last
 				}
-				c.Characters = charsList
-				creatorsArray := strings.Split(creators, ", ")
-				creatsList := NamableList{}
-				for _, creator := range creatorsArray {
-					cr, exists := creatsMap[creator]
-					if !exists {
-						creatID++
-						cID, err := getCode(creatID)
+				for _, ch := range c.Characters {
+					charC := *(charsComics[ch.ID])
+					if len(charC) <= 0 {
+						sID, err := getCode(r.SortID)
 						if err != nil {
 							return err
 						}
-						cr = Namable{ID: cID, Name: creator}
-						creatsMap[creator] = cr
-						creatsMap[cID] = cr
-						creatsComics[cID] = &ComicList{}
-						creats = append(creats, cr)
-					}
-					creatsList = append(creatsList, cr)
-				}
-				c.Creators = creatsList
-				c.Pic = pic
-				c.Universe = universe
-				c.Essential = essential == "YES"
-				if comments != "" {
-					c.Comments = strings.Split(comments, ", ")
-				}
-				c.PhaseID = p.ID
-				c.PhaseName = p.Name
-				if title != lastTitle {
-					sortID++
-					lastTitle = title
-					sID, err := getCode(sortID)
-					if err != nil {
-						return err
-					}
-					co := Comic{
-						Pic:        pic,
-						Title:      title,
-						Date:       date,
-						SortID:     sID,
-						PhaseID:    p.ID,
-						Characters: NamableList{c.Characters[0]},
-						Essential: c.Essential,
-						ComicList: []Comic{
-							Comic{
-								Collection: c.Collection,
-								Vol:        c.Vol,
-								Num:        c.Num,
+						tmp := Comic{
+							Pic:        r.Pic,
+							Title:      r.Title,
+							Date:       r.Date,
+							SortID:     sID,
+							PhaseID:    p.ID,
+							Essential: c.Essential,
+							ComicList: []Comic{
+								Comic{
+									Collection: c.Collection,
+									Vol:        c.Vol,
+									Num:        c.Num,
+								},
 							},
-						},
-					}
-					iPhases.List = append(iPhases.List, co)
-					if event != "" {
-						co.Event = event
-						*(eventsComics[c.EventID]) = append(*(eventsComics[c.EventID]), co)
-					}
-					for _, ch := range c.Characters {
-						*(charsComics[ch.ID]) = append(*(charsComics[ch.ID]), co)
-					}
-					for _, cr := range c.Creators {
-						*(creatsComics[cr.ID]) = append(*(creatsComics[cr.ID]), co)
-					}
-				} else {
-					co := Comic{
-						Collection: c.Collection,
-						Vol:        c.Vol,
-						Num:        c.Num,
-					}
-					last := iPhases.List[len(iPhases.List)-1]
-					last.ComicList = append(last.ComicList, co)
-					iPhases.List[len(iPhases.List)-1] = last
-					if event != "" {
-						eventC := *(eventsComics[c.EventID])
-						last := eventC[len(eventC)-1]
-						last.ComicList = append(last.ComicList, co)
-						eventC[len(eventC)-1] = last
-					}
-					for _, ch := range c.Characters {
-						charC := *(charsComics[ch.ID])
-						if len(charC) <= 0 {
-							sID, err := getCode(sortID)
+						}
+						charC = append(charC, tmp)
+						charsComics[ch.ID] = &charC
+					} else {
+						last := charC[len(charC)-1]
+						if last.Title != r.Title {
+							sID, err := getCode(r.SortID)
 							if err != nil {
 								return err
 							}
 							tmp := Comic{
-								Pic:        pic,
-								Title:      title,
-								Date:       date,
+								Pic:        r.Pic,
+								Title:      r.Title,
+								Date:       r.Date,
 								SortID:     sID,
 								PhaseID:    p.ID,
-								Characters: NamableList{c.Characters[0]},
 								Essential: c.Essential,
 								ComicList: []Comic{
 									Comic{
@@ -267,50 +249,48 @@ func JsonGenerator(path, out string) error {
 							charC = append(charC, tmp)
 							charsComics[ch.ID] = &charC
 						} else {
-							last := charC[len(charC)-1]
-							if last.Title != title {
-								sID, err := getCode(sortID)
-								if err != nil {
-									return err
-								}
-								tmp := Comic{
-									Pic:        pic,
-									Title:      title,
-									Date:       date,
-									SortID:     sID,
-									PhaseID:    p.ID,
-									Characters: NamableList{c.Characters[0]},
-									Essential: c.Essential,
-									ComicList: []Comic{
-										Comic{
-											Collection: c.Collection,
-											Vol:        c.Vol,
-											Num:        c.Num,
-										},
-									},
-								}
-								charC = append(charC, tmp)
-								charsComics[ch.ID] = &charC
-							} else {
-								last.ComicList = append(last.ComicList, co)
-								charC[len(charC)-1] = last
-							}
+							last.ComicList = append(last.ComicList, co)
+							charC[len(charC)-1] = last
 						}
 					}
-					for _, cr := range c.Creators {
-						creatC := *(creatsComics[cr.ID])
-						if len(creatC) <= 0 {
-							sID, err := getCode(sortID)
+				}
+				for _, cr := range c.Creators {
+					creatC := *(creatsComics[cr.ID])
+					if len(creatC) <= 0 {
+						sID, err := getCode(r.SortID)
+						if err != nil {
+							return err
+						}
+						tmp := Comic{
+							Pic:        r.Pic,
+							Title:      r.Title,
+							Date:       r.Date,
+							SortID:     sID,
+							PhaseID:    p.ID,
+							Essential: c.Essential,
+							ComicList: []Comic{
+								Comic{
+									Collection: c.Collection,
+									Vol:        c.Vol,
+									Num:        c.Num,
+								},
+							},
+						}
+						creatC = append(creatC, tmp)
+						creatsComics[cr.ID] = &creatC
+					} else {
+						last := creatC[len(creatC)-1]
+						if last.Title != r.Title {
+							sID, err := getCode(r.SortID)
 							if err != nil {
 								return err
 							}
 							tmp := Comic{
-								Pic:        pic,
-								Title:      title,
-								Date:       date,
+								Pic:        r.Pic,
+								Title:      r.Title,
+								Date:       r.Date,
 								SortID:     sID,
 								PhaseID:    p.ID,
-								Characters: NamableList{c.Characters[0]},
 								Essential: c.Essential,
 								ComicList: []Comic{
 									Comic{
@@ -323,46 +303,30 @@ func JsonGenerator(path, out string) error {
 							creatC = append(creatC, tmp)
 							creatsComics[cr.ID] = &creatC
 						} else {
-							last := creatC[len(creatC)-1]
-							if last.Title != title {
-								sID, err := getCode(sortID)
-								if err != nil {
-									return err
-								}
-								tmp := Comic{
-									Pic:        pic,
-									Title:      title,
-									Date:       date,
-									SortID:     sID,
-									PhaseID:    p.ID,
-									Characters: NamableList{c.Characters[0]},
-									Essential: c.Essential,
-									ComicList: []Comic{
-										Comic{
-											Collection: c.Collection,
-											Vol:        c.Vol,
-											Num:        c.Num,
-										},
-									},
-								}
-								creatC = append(creatC, tmp)
-								creatsComics[cr.ID] = &creatC
-							} else {
-								last.ComicList = append(last.ComicList, co)
-								creatC[len(creatC)-1] = last
-							}
+							last.ComicList = append(last.ComicList, co)
+							creatC[len(creatC)-1] = last
 						}
 					}
 				}
-				c.SortID, err = getCode(sortID)
-				if err != nil {
-					return err
-				}
-				comics = append(comics, c)
-				cp = append(cp, c)
 			}
+			c.SortID, err = getCode(r.SortID)
+			if err != nil {
+				return err
+			}
+			key := groupKey(c.PhaseID, c.SortID)
+			if _, exists := protagonistNames[key]; !exists && r.Protagonist != "" {
+				protagonistNames[key] = r.Protagonist
+			}
+			cp = append(cp, c)
 		}
 
+		// Protagonists, now that all issues of each title are read
+		err = setProtagonists(cp, protagonistNames, protagonists)
+		if err != nil {
+			return err
+		}
+		setFissuesProtagonists(iPhases.List, protagonists)
+		comics = append(comics, cp...)
 		fissuesPhases = append(fissuesPhases, iPhases)
 		Datastore[fmt.Sprintf("comics-phase-%s", p.ID)] = &cp
 	}
@@ -380,6 +344,7 @@ func JsonGenerator(path, out string) error {
 		for _, e := range *value {
 			iEvents.List = append(iEvents.List, e)
 		}
+		setFissuesProtagonists(iEvents.List, protagonists)
 		iEvents.Namable = Namable{ID: key, Name: (*value)[0].Event}
 		fissuesEvents = append(fissuesEvents, iEvents)
 	}
@@ -392,6 +357,7 @@ func JsonGenerator(path, out string) error {
 		for _, c := range *value {
 			iChars.List = append(iChars.List, c)
 		}
+		setFissuesProtagonists(iChars.List, protagonists)
 		iChars.Namable = charsMap[key]
 		fissuesChars = append(fissuesChars, iChars)
 	}
@@ -404,6 +370,7 @@ func JsonGenerator(path, out string) error {
 		for _, c := range *value {
 			iCreats.List = append(iCreats.List, c)
 		}
+		setFissuesProtagonists(iCreats.List, protagonists)
 		iCreats.Namable = creatsMap[key]
 		fissuesCreators = append(fissuesCreators, iCreats)
 	}
@@ -412,7 +379,8 @@ func JsonGenerator(path, out string) error {
 }
 
 // Update XLSX from MARVEL API
-func UpdateXLSX(path string, start, end int, mPubKey, mPriKey string) error {
+// With roles, creators of rows filled before roles were kept are fetched again
+func UpdateXLSX(path string, start, end int, mPubKey, mPriKey string, roles bool) error {
 	// Open file
 	xls, err := xlsx.OpenFile(path)
 	if err != nil {
@@ -489,6 +457,15 @@ func UpdateXLSX(path string, start, end int, mPubKey, mPriKey string) error {
 								row.Cells[pic_col].SetString(data.Pic)
 							}
 						}
+						if roles && creators != "" && !cellHasRoles(creators) {
+							fmt.Printf("[Finding roles] %s\n", id)
+							data, err := m.FindByID(id)
+							if err != nil {
+								fmt.Printf("%s\n", err.Error())
+							} else {
+								row.Cells[creators_col].SetString(data.Creators)
+							}
+						}
 					}
 				}
 			}
@@ -502,146 +479,26 @@ func UpdateXLSX(path string, start, end int, mPubKey, mPriKey string) error {
 	return nil
 }
 
-// Create folders structure based on XLSX
-func CreateFolders(f, path string) error {
-	// Open file
-	xls, err := xlsx.OpenFile(f)
-	if err != nil {
-		return err
-	}
-
-	// Read all files in path
-	phaseFiles, err := ioutil.ReadDir(path)
-	if err != nil {
-		return err
+// Util
+// Creators may carry their role, as the MARVEL API gives it: 'Jae Lee (penciller (cover))'
+func splitCreator(s string) (string, string) {
+	i := strings.Index(s, " (")
+	if i < 0 || !strings.HasSuffix(s, ")") {
+		return s, ""
 	}
+	return s[:i], s[i+2 : len(s)-1]
+}
 
-	// Loop through file sheets
-	for sheet_i, sheet := range xls.Sheets {
-		// Get starter code
-		starter, err := getCode(sheet_i + 1)
-		if err != nil {
-			return err
-		}
-		// Find folder
-		phaseFolderName := fmt.Sprintf("%v - %s", starter, sheet.Name)
-		phaseFolderNameFull := fmt.Sprintf("%s/%s", path, phaseFolderName)
-		found := false
-		for _, file := range phaseFiles {
-			if file.IsDir() && file.Name() == phaseFolderName {
-				found = true
-			}
-		}
-		// Create folder if it doesn't exist
-		if !found {
-			fmt.Printf("[Creating folder] %s\n", phaseFolderNameFull)
-			os.Mkdir(phaseFolderNameFull, os.ModeDir)
-		}
-
-		// Read all files in this phase
-		files, err := ioutil.ReadDir(phaseFolderNameFull)
-		if err != nil {
-			return err
-		}
-
-		// Loop throw rows to check second level folders
-		sortID := 0
-		lastTitle := ""
-		for _, row := range sheet.Rows[1:] {
-			filesModified := false
-			id, err := row.Cells[id_col].String()
-			if err != nil {
-				return err
-			}
-			fill := row.Cells[id_col].GetStyle().Fill
-			collection, err := row.Cells[collection_col].String()
-			if err != nil {
-				return err
-			}
-			title, err := row.Cells[title_col].String()
-			if err != nil {
-				return err
-			}
-			vol, err := row.Cells[vol_col].Int()
-			if err != nil {
-				return err
-			}
-			num, err := row.Cells[num_col].Int()
-			if err != nil {
-				return err
-			}
-			isNew := false
-			if id == "" && fill.PatternType != "solid" && fill.FgColor != "FFFF0000" {
-				isNew = true
-				fmt.Printf("[New comic found] %s %v %v\n", collection, vol, num)
-			}
-			needNewFolder := false
-			if title != lastTitle {
-				sortID++
-				lastTitle = title
-				needNewFolder = isNew
-			}
-			// Get code
-			code, err := getCode(sortID)
-			if err != nil {
-				return err
-			}
-			// Find folder
-			folderName := fmt.Sprintf("%s/%s", phaseFolderNameFull, code)
-			exists := ""
-			for _, file := range files {
-				if file.IsDir() && strings.HasPrefix(file.Name(), code) {
-					exists = file.Name()
-				}
-			}
-			if needNewFolder && exists != "" {
-				// Rename folders from 'sortID' until last
-				for i := len(files); i >= sortID; i-- {
-					oldCode, err := getCode(i)
-					if err != nil {
-						return err
-					}
-					newCode, err := getCode(i + 1)
-					if err != nil {
-						return err
-					}
-					found := ""
-					for _, file := range files {
-						if file.IsDir() && strings.HasPrefix(file.Name(), oldCode) {
-							found = file.Name()
-						}
-					}
-					if found == "" {
-						return fmt.Errorf("[Error] Cannot find folder to rename")
-					}
-
-					oldPath := fmt.Sprintf("%s/%s", phaseFolderNameFull, found)
-					newPath := fmt.Sprintf("%s/%s", phaseFolderNameFull, newCode)
-					fmt.Printf("[Renaming folders] From %v to %v\n", oldPath, newPath)
-					os.Rename(oldPath, newPath)
-					filesModified = true
-				}
-			}
-			// Create folder if it doesn't exist
-			if (needNewFolder && exists != "") || exists == "" {
-				fmt.Printf("[Creating folder] %s (%s %v %v)\n", folderName, collection, vol, num)
-				os.Mkdir(folderName, os.ModeDir)
-				filesModified = true
-			}
-			// Refresh files
-			if filesModified {
-				files, err = ioutil.ReadDir(phaseFolderNameFull)
-				if err != nil {
-					return err
-				}
-			}
+// True if any creator in the cell carries a role
+func cellHasRoles(creators string) bool {
+	for _, cr := range strings.Split(creators, ", ") {
+		if _, role := splitCreator(cr); role != "" {
+			return true
 		}
 	}
-
-	return nil
+	return false
 }
 
-// Util
 func getCode(i int) (string, error) {
 	if i > 999 {
 		return "", fmt.Errorf("[Error] Cannot get code higer than 999")
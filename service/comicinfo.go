@@ -0,0 +1,293 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const comicInfoFile = "ComicInfo.xml"
+
+// ComicInfo.xml, as read by comic readers like Komga or Kavita
+// Reading order goes as an alternate series: phase, then sortid
+type ComicInfo struct {
+	XMLName         xml.Name `xml:"ComicInfo"`
+	Title           string   `xml:"Title,omitempty"`
+	Series          string   `xml:"Series"`
+	Number          string   `xml:"Number"`
+	Volume          int      `xml:"Volume,omitempty"`
+	AlternateSeries string   `xml:"AlternateSeries,omitempty"`
+	AlternateNumber string   `xml:"AlternateNumber,omitempty"`
+	StoryArc        string   `xml:"StoryArc,omitempty"`
+	SeriesGroup     string   `xml:"SeriesGroup,omitempty"`
+	Notes           string   `xml:"Notes,omitempty"`
+	Year            int      `xml:"Year,omitempty"`
+	Month           int      `xml:"Month,omitempty"`
+	Day             int      `xml:"Day,omitempty"`
+	Writer          string   `xml:"Writer,omitempty"`
+	Penciller       string   `xml:"Penciller,omitempty"`
+	Inker           string   `xml:"Inker,omitempty"`
+	Colorist        string   `xml:"Colorist,omitempty"`
+	Letterer        string   `xml:"Letterer,omitempty"`
+	CoverArtist     string   `xml:"CoverArtist,omitempty"`
+	Editor          string   `xml:"Editor,omitempty"`
+	Publisher       string   `xml:"Publisher,omitempty"`
+	Characters      string   `xml:"Characters,omitempty"`
+}
+
+// Publisher is left out when empty
+func NewComicInfo(c Comic, publisher string) *ComicInfo {
+	info := &ComicInfo{
+		Title:           c.Title,
+		Series:          c.Collection,
+		Number:          strconv.FormatFloat(c.Num, 'f', -1, 64),
+		Volume:          c.Vol,
+		AlternateSeries: fmt.Sprintf("%s - %s", c.PhaseID, c.PhaseName),
+		AlternateNumber: c.SortID,
+		StoryArc:        c.Event,
+		SeriesGroup:     c.PhaseName,
+		Publisher:       publisher,
+	}
+	info.Notes = fmt.Sprintf("Reading order: phase %s (%s), %s", c.PhaseID, c.PhaseName, c.SortID)
+	if len(c.Comments) > 0 {
+		info.Notes = fmt.Sprintf("%s. %s", info.Notes, strings.Join(c.Comments, ". "))
+	}
+
+	// Date is 'YYYY-MM-DD'
+	date := strings.Split(c.Date, "-")
+	if len(date) == 3 {
+		info.Year, _ = strconv.Atoi(date[0])
+		info.Month, _ = strconv.Atoi(date[1])
+		info.Day, _ = strconv.Atoi(date[2])
+	}
+
+	names := []string{}
+	for _, ch := range c.Characters {
+		names = append(names, ch.Name)
+	}
+	info.Characters = strings.Join(names, ", ")
+
+	// Creators with no known role are left out
+	credits := map[*string][]string{}
+	for _, cr := range c.Creators {
+		for _, role := range strings.Split(cr.Role, ", ") {
+			field := info.creditField(role)
+			if field != nil {
+				credits[field] = appendOnce(credits[field], cr.Name)
+			}
+		}
+	}
+	for field, names := range credits {
+		*field = strings.Join(names, ", ")
+	}
+	return info
+}
+
+func (n NamableList) hasRoles() bool {
+	for _, cr := range n {
+		if cr.Role != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Field for a MARVEL API role: 'writer', 'penciller (cover)', 'inker'...
+func (info *ComicInfo) creditField(role string) *string {
+	role = strings.ToLower(role)
+	switch {
+	case strings.Contains(role, "cover"):
+		return &info.CoverArtist
+	case strings.HasPrefix(role, "writer"):
+		return &info.Writer
+	case strings.HasPrefix(role, "pencil"), strings.HasPrefix(role, "artist"):
+		return &info.Penciller
+	case strings.HasPrefix(role, "inker"):
+		return &info.Inker
+	case strings.HasPrefix(role, "colorist"):
+		return &info.Colorist
+	case strings.HasPrefix(role, "letterer"):
+		return &info.Letterer
+	case strings.HasPrefix(role, "editor"):
+		return &info.Editor
+	}
+	return nil
+}
+
+func appendOnce(l []string, s string) []string {
+	for _, e := range l {
+		if e == s {
+			return l
+		}
+	}
+	return append(l, s)
+}
+
+func (info *ComicInfo) ToXml() ([]byte, error) {
+	bytes, err := xml.MarshalIndent(info, "", "	")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), bytes...), nil
+}
+
+// Write ComicInfo.xml into every CBZ file in the library matching a comic
+// Files are matched as in ScanLibrary, a ComicInfo.xml already there is replaced
+func WriteComicInfo(data, path, publisher string, dryRun bool) error {
+	all, err := readJsonFile(fmt.Sprintf("%s/comics.json", data))
+	if err != nil {
+		return err
+	}
+	list, err := ListAllComics(all)
+	if err != nil {
+		return err
+	}
+	comics := *list
+	issues := make([]LibraryIssue, len(comics))
+	for i, c := range comics {
+		issues[i] = LibraryIssue{
+			PhaseID:    c.PhaseID,
+			PhaseName:  c.PhaseName,
+			SortID:     c.SortID,
+			Title:      c.Title,
+			Collection: c.Collection,
+			Vol:        c.Vol,
+			Num:        c.Num,
+		}
+	}
+	files, err := findLibraryFiles(path)
+	if err != nil {
+		return err
+	}
+
+	index := newIssueIndex(issues)
+	written := 0
+	warned := make(map[string]bool) // Titles with creators and no roles
+	for _, file := range files {
+		if strings.ToLower(filepath.Ext(file.Path)) != ".cbz" {
+			continue
+		}
+		i, found := index.find(file)
+		if !found {
+			fmt.Printf("[Unmatched] %s\n", file.Path)
+			continue
+		}
+		fmt.Printf("[Writing] %s (%s)\n", file.Path, issues[i])
+		written++
+		key := groupKey(comics[i].PhaseID, comics[i].SortID)
+		if !warned[key] && len(comics[i].Creators) > 0 && !comics[i].Creators.hasRoles() {
+			fmt.Printf("[No roles] %s - %s: '%s' gets no credits, run -update -roles and -generate\n", comics[i].PhaseID, comics[i].SortID, comics[i].Title)
+			warned[key] = true
+		}
+		if dryRun {
+			continue
+		}
+		err = writeComicInfoFile(file.Path, NewComicInfo(comics[i], publisher))
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%v CBZ files matched\n", written)
+	return nil
+}
+
+// Zip files cannot be changed in place: copy all but the old ComicInfo.xml
+// aside, then rename over the original
+func writeComicInfoFile(p string, info *ComicInfo) error {
+	bytes, err := info.ToXml()
+	if err != nil {
+		return err
+	}
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return fmt.Errorf("Cannot read file '%s': %v", p, err)
+	}
+	defer r.Close()
+
+	tmp := fmt.Sprintf("%s.tmp", p)
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("Cannot write file '%s': %v", tmp, err)
+	}
+	err = copyWithComicInfo(&r.Reader, out, bytes)
+	if errClose := out.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Cannot write file '%s': %v", tmp, err)
+	}
+	err = os.Rename(tmp, p)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Cannot write file '%s': %v", p, err)
+	}
+	return nil
+}
+
+func copyWithComicInfo(r *zip.Reader, out io.Writer, info []byte) error {
+	w := zip.NewWriter(out)
+	for _, f := range r.File {
+		if strings.EqualFold(filepath.Base(f.Name), comicInfoFile) {
+			continue
+		}
+		header := f.FileHeader
+		dst, err := w.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	dst, err := w.Create(comicInfoFile)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(info)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func readComicInfo(p string) (*ComicInfo, error) {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if !strings.EqualFold(filepath.Base(f.Name), comicInfoFile) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		bytes, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		info := &ComicInfo{}
+		err = xml.Unmarshal(bytes, info)
+		if err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("No %s in '%s'", comicInfoFile, p)
+}
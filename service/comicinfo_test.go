@@ -0,0 +1,119 @@
+package service
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func siege() Comic {
+	return Comic{
+		Title: "Siege", Collection: "Siege", Vol: 1, Num: 1, Date: "2010-01-06", Event: "Siege",
+		PhaseID: "007", PhaseName: "Heroic Age", SortID: "012", Comments: []string{"Start here"},
+		Characters: NamableList{{ID: "001", Name: "Thor"}, {ID: "002", Name: "Ares"}},
+		Creators: NamableList{
+			{ID: "001", Name: "Brian Michael Bendis", Role: "writer"},
+			{ID: "002", Name: "Olivier Coipel", Role: "penciller"},
+			{ID: "002", Name: "Olivier Coipel", Role: "penciller (cover)"},
+			{ID: "003", Name: "Mark Morales", Role: "inker"},
+			{ID: "004", Name: "Tom Brevoort", Role: "editor"},
+			{ID: "005", Name: "Laura Martin", Role: "colorist, letterer"},
+			{ID: "006", Name: "Someone", Role: "production"},
+		},
+	}
+}
+
+func TestNewComicInfo(t *testing.T) {
+	tests := []struct {
+		name      string
+		comic     func(c *Comic)
+		publisher string
+		want      ComicInfo
+	}{
+		{"issue", func(c *Comic) {}, "Marvel", ComicInfo{
+			Title: "Siege", Series: "Siege", Number: "1", Volume: 1,
+			AlternateSeries: "007 - Heroic Age", AlternateNumber: "012", StoryArc: "Siege", SeriesGroup: "Heroic Age",
+			Notes: "Reading order: phase 007 (Heroic Age), 012. Start here", Year: 2010, Month: 1, Day: 6,
+			Writer: "Brian Michael Bendis", Penciller: "Olivier Coipel", Inker: "Mark Morales", Colorist: "Laura Martin",
+			Letterer: "Laura Martin", CoverArtist: "Olivier Coipel", Editor: "Tom Brevoort", Publisher: "Marvel",
+			Characters: "Thor, Ares",
+		}},
+		{"no roles nor publisher", func(c *Comic) {
+			c.Num, c.Date, c.Event, c.Comments = 0.1, "", "", nil
+			c.Characters = nil
+			c.Creators = NamableList{{ID: "001", Name: "Brian Michael Bendis"}}
+		}, "", ComicInfo{
+			Title: "Siege", Series: "Siege", Number: "0.1", Volume: 1,
+			AlternateSeries: "007 - Heroic Age", AlternateNumber: "012", SeriesGroup: "Heroic Age",
+			Notes: "Reading order: phase 007 (Heroic Age), 012",
+		}},
+		{"annual", func(c *Comic) {
+			c.Collection, c.Num, c.Date = "Siege Annual", 2010, "2010-12"
+		}, "Marvel", ComicInfo{
+			Title: "Siege", Series: "Siege Annual", Number: "2010", Volume: 1,
+			AlternateSeries: "007 - Heroic Age", AlternateNumber: "012", StoryArc: "Siege", SeriesGroup: "Heroic Age",
+			Notes:  "Reading order: phase 007 (Heroic Age), 012. Start here",
+			Writer: "Brian Michael Bendis", Penciller: "Olivier Coipel", Inker: "Mark Morales", Colorist: "Laura Martin",
+			Letterer: "Laura Martin", CoverArtist: "Olivier Coipel", Editor: "Tom Brevoort", Publisher: "Marvel",
+			Characters: "Thor, Ares",
+		}},
+	}
+	for _, e := range tests {
+		c := siege()
+		e.comic(&c)
+		got := NewComicInfo(c, e.publisher)
+		if !reflect.DeepEqual(*got, e.want) {
+			t.Errorf("%s: expected %+v, got %+v", e.name, e.want, *got)
+		}
+	}
+}
+
+// The old ComicInfo.xml is replaced, pages are kept
+func TestWriteComicInfoFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "comicinfo")
+	if err != nil {
+		t.Fatalf("Cannot create temporary folder: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "Siege v1 #001.cbz")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("Cannot create file: %v", err)
+	}
+	w := zip.NewWriter(f)
+	for name, content := range map[string]string{"001.jpg": "page", "comicinfo.xml": "<ComicInfo><Series>Old</Series></ComicInfo>"} {
+		dst, _ := w.Create(name)
+		dst.Write([]byte(content))
+	}
+	w.Close()
+	f.Close()
+
+	want := NewComicInfo(siege(), "Marvel")
+	err = writeComicInfoFile(p, want)
+	if err != nil {
+		t.Fatalf("Cannot write %s: %v", comicInfoFile, err)
+	}
+	got, err := readComicInfo(p)
+	if err != nil {
+		t.Fatalf("Cannot read %s: %v", comicInfoFile, err)
+	}
+	got.XMLName = want.XMLName
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", *want, *got)
+	}
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		t.Fatalf("Cannot read file: %v", err)
+	}
+	defer r.Close()
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"001.jpg", comicInfoFile}) {
+		t.Errorf("Expected the page and %s, got %v", comicInfoFile, names)
+	}
+}
@@ -7,19 +7,20 @@ import (
 
 // XLSX columns
 const (
-	id_col         = 0
-	collection_col = 1
-	vol_col        = 2
-	num_col        = 3
-	title_col      = 4
-	date_col       = 5
-	event_col      = 6
-	characters_col = 7
-	creators_col   = 8
-	pic_col        = 9
-	universe_col   = 10
-	essential_col  = 11
-	comments_col   = 12
+	id_col          = 0
+	collection_col  = 1
+	vol_col         = 2
+	num_col         = 3
+	title_col       = 4
+	date_col        = 5
+	event_col       = 6
+	characters_col  = 7
+	creators_col    = 8
+	pic_col         = 9
+	universe_col    = 10
+	essential_col   = 11
+	comments_col    = 12
+	protagonist_col = 13 // Optional, character name
 
 	mandatory_cols = 12
 )
@@ -36,24 +37,26 @@ var Datastore = DatastoreType{}
 
 // Comics
 type Comic struct {
-	ID         string      `json:"id,omitempty"`         // From Marvel API
-	Collection string      `json:"collection,omitempty"` // From XLSX
-	Title      string      `json:"title,omitempty"`      // From XLSX
-	Vol        int         `json:"vol,omitempty"`        // From XLSX
-	Num        float64     `json:"num,omitempty"`        // From XLSX
-	Date       string      `json:"date,omitempty"`       // From Marvel API
-	Event      string      `json:"event,omitempty"`      // From XLSX
-	EventID    string      `json:"eventid,omitempty"`    // From XLSX
-	Characters NamableList `json:"characters,omitempty"` // From Marvel API
-	Creators   NamableList `json:"creators,omitempty"`   // From Marvel API
-	Pic        string      `json:"pic,omitempty"`        // From Marvel API
-	Universe   string      `json:"universe,omitempty"`   // From XLSX
-	Essential  bool        `json:"essential,omitempty"`  // From XLSX
-	Comments   []string    `json:"comments,omitempty"`   // From XLSX
-	PhaseID    string      `json:"phaseid,omitempty"`    // From XLSX: Generated based on sheet position
-	PhaseName  string      `json:"phasename,omitempty"`  // From XLSX: Generated based on sheet name
-	SortID     string      `json:"sortid,omitempty"`     // From XLSX: Generated based on row position
-	ComicList  ComicList   `json:"comiclist,omitempty"`  // Null: Used only in Fissues
+	ID          string         `json:"id,omitempty"`          // From Marvel API
+	Collection  string         `json:"collection,omitempty"`  // From XLSX
+	Title       string         `json:"title,omitempty"`       // From XLSX
+	Vol         int            `json:"vol,omitempty"`         // From XLSX
+	Num         float64        `json:"num,omitempty"`         // From XLSX
+	Date        string         `json:"date,omitempty"`        // From Marvel API
+	Event       string         `json:"event,omitempty"`       // From XLSX
+	EventID     string         `json:"eventid,omitempty"`     // From XLSX
+	Characters  NamableList    `json:"characters,omitempty"`  // From Marvel API
+	Creators    NamableList    `json:"creators,omitempty"`    // From Marvel API
+	Pic         string         `json:"pic,omitempty"`         // From Marvel API
+	Universe    string         `json:"universe,omitempty"`    // From XLSX
+	Essential   bool           `json:"essential,omitempty"`   // From XLSX
+	Comments    []string       `json:"comments,omitempty"`    // From XLSX
+	PhaseID     string         `json:"phaseid,omitempty"`     // From XLSX: Generated based on sheet position
+	PhaseName   string         `json:"phasename,omitempty"`   // From XLSX: Generated based on sheet name
+	SortID      string         `json:"sortid,omitempty"`      // From XLSX: Generated based on row position
+	ComicList   ComicList      `json:"comiclist,omitempty"`   // Null: Used only in Fissues
+	Ranges      IssueRangeList `json:"ranges,omitempty"`      // Null: Used only in Fissues, from ComicList
+	Protagonist *Namable       `json:"protagonist,omitempty"` // From XLSX or its characters: Generated per title
 }
 type ComicList []Comic
 
@@ -77,6 +80,7 @@ func (c *ComicList) IsEmpty() bool {
 type Namable struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	Role string `json:"role,omitempty"` // Only for creators of a comic, when known
 }
 type NamableList []Namable
 
@@ -125,6 +129,17 @@ func (f *FissuesList) IsEmpty() bool {
 	return len(*f) <= 0
 }
 
+// First issues by type: phases, events, characters, creators
+type FissuesMap map[string]*FissuesList
+
+func (f *FissuesMap) ToJson() ([]byte, error) {
+	return json.MarshalIndent(f, "", "	")
+}
+
+func (f *FissuesMap) IsEmpty() bool {
+	return len(*f) <= 0
+}
+
 // Constructors from jsonql
 func NewComic(in interface{}) (Comic, error) {
 	m := in.(map[string]interface{})
@@ -196,6 +211,17 @@ func NewComic(in interface{}) (Comic, error) {
 				return c, err
 			}
 			c.ComicList = *list
+			c.Ranges = GetIssueRanges(c.ComicList)
+			break
+		case "ranges":
+			// Always made from comiclist
+			break
+		case "protagonist":
+			namable, err := NewNamable(e)
+			if err != nil {
+				return c, err
+			}
+			c.Protagonist = &namable
 			break
 		default:
 			return c, fmt.Errorf("Unknown field: %v", i)
@@ -239,6 +265,9 @@ func NewNamable(in interface{}) (Namable, error) {
 		case "name":
 			n.Name = e.(string)
 			break
+		case "role":
+			n.Role = e.(string)
+			break
 		default:
 			return n, fmt.Errorf("Unknown field: %v", i)
 		}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/elgs/jsonql"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Export formats
+const (
+	ExportCSV      = "csv"
+	ExportMarkdown = "markdown"
+	ExportHTML     = "html"
+)
+
+var ExportFormats = []string{ExportCSV, ExportMarkdown, ExportHTML}
+
+// What can be exported: one of the first issues lists, or all comics
+const ExportComics = "comics"
+
+var ExportTypes = []string{"phases", "events", "characters", "creators", ExportComics}
+
+// Reading order ready to export, one row per comic
+type Export struct {
+	Title string
+	Rows  []ExportRow
+}
+
+type ExportRow struct {
+	Phase     string
+	PhaseID   string
+	SortID    string
+	Title     string
+	Year      string
+	Essential bool
+	Issues    []string
+}
+
+// Export first issues list
+func ExportFissues(f *Fissues) *Export {
+	e := &Export{Title: f.Namable.Name}
+	for _, c := range f.List {
+		e.Rows = append(e.Rows, newExportRow(c, c.ComicList))
+	}
+	return e
+}
+
+// Export all comics, one row per comic in reading order
+func ExportComicList(title string, comics *ComicList) *Export {
+	e := &Export{Title: title}
+	l := append(ComicList{}, *comics...)
+	less, _ := comicSorter(l, "order")
+	sort.SliceStable(l, less)
+	for i := 0; i < len(l); {
+		j := i
+		for j < len(l) && l[j].PhaseID == l[i].PhaseID && l[j].SortID == l[i].SortID {
+			j++
+		}
+		e.Rows = append(e.Rows, newExportRow(l[i], l[i:j]))
+		i = j
+	}
+	return e
+}
+
+func newExportRow(c Comic, issues ComicList) ExportRow {
+	year := c.Date
+	if len(year) > 4 {
+		year = year[:4]
+	}
+	return ExportRow{
+		Phase:     c.PhaseName,
+		PhaseID:   c.PhaseID,
+		SortID:    c.SortID,
+		Title:     c.Title,
+		Year:      year,
+		Essential: c.Essential,
+		Issues:    GetIssueRanges(issues).Strings(),
+	}
+}
+
+func ValidateExportFormat(format string) error {
+	for _, e := range ExportFormats {
+		if e == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid format '%s': must be one of %v", format, ExportFormats)
+}
+
+func ValidateExportType(t string) error {
+	for _, e := range ExportTypes {
+		if e == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid type '%s': must be one of %v", t, ExportTypes)
+}
+
+func ExportContentType(format string) string {
+	switch format {
+	case ExportCSV:
+		return "text/csv; charset=utf-8"
+	case ExportMarkdown:
+		return "text/markdown; charset=utf-8"
+	}
+	return "text/html; charset=utf-8"
+}
+
+func ExportExtension(format string) string {
+	switch format {
+	case ExportMarkdown:
+		return "md"
+	}
+	return format
+}
+
+func (e *Export) Write(w io.Writer, format string) error {
+	switch format {
+	case ExportCSV:
+		return e.writeCSV(w)
+	case ExportMarkdown:
+		return e.writeMarkdown(w)
+	case ExportHTML:
+		return exportTemplate.Execute(w, e)
+	}
+	return ValidateExportFormat(format)
+}
+
+func (e *Export) writeCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"phase", "phaseid", "sortid", "title", "year", "essential", "issues"})
+	for _, r := range e.Rows {
+		c.Write([]string{r.Phase, r.PhaseID, r.SortID, r.Title, r.Year, fmt.Sprintf("%v", r.Essential), strings.Join(r.Issues, "; ")})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// Checklist, with a heading per phase
+func (e *Export) writeMarkdown(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# %s\n", e.Title)
+	if err != nil {
+		return err
+	}
+	phase := ""
+	for i, r := range e.Rows {
+		if r.Phase != phase {
+			phase = r.Phase
+			fmt.Fprintf(w, "\n## %s\n\n", phase)
+		} else if i == 0 {
+			fmt.Fprint(w, "\n")
+		}
+		essential := ""
+		if r.Essential {
+			essential = " **(essential)**"
+		}
+		_, err = fmt.Fprintf(w, "- [ ] %s (%s)%s: %s\n", r.Title, r.Year, essential, strings.Join(r.Issues, ", "))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Single page, fit to print
+var exportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+	body { font-family: sans-serif; font-size: 11pt; margin: 2em; }
+	h1 { font-size: 16pt; }
+	h2 { font-size: 13pt; margin-top: 1.5em; }
+	ul { list-style: none; padding: 0; }
+	li { margin: 0.3em 0; page-break-inside: avoid; }
+	li span { color: #555; }
+	@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{$phase := ""}}<ul>{{range .Rows}}{{if and .Phase (ne .Phase $phase)}}{{$phase = .Phase}}</ul>
+<h2>{{.Phase}}</h2>
+<ul>{{end}}
+	<li>&#9744; <b>{{.Title}}</b> ({{.Year}}){{if .Essential}} <i>essential</i>{{end}}<br><span>{{range $i, $e := .Issues}}{{if $i}}, {{end}}{{$e}}{{end}}</span></li>{{end}}
+</ul>
+</body>
+</html>
+`))
+
+// Export from generated JSON files
+// Writes to stdout when out is empty
+func ExportFile(data, t, id, format, out string) error {
+	err := ValidateExportType(t)
+	if err != nil {
+		return err
+	}
+	err = ValidateExportFormat(format)
+	if err != nil {
+		return err
+	}
+	var e *Export
+	if t == ExportComics {
+		comics, err := readJsonFile(fmt.Sprintf("%s/comics.json", data))
+		if err != nil {
+			return err
+		}
+		list, err := ListAllComics(comics)
+		if err != nil {
+			return err
+		}
+		e = ExportComicList("Reading order", list)
+	} else {
+		fissues, err := readJsonFile(fmt.Sprintf("%s/fissues-%s.json", data, t))
+		if err != nil {
+			return err
+		}
+		f, err := FindFirstIssuesByID(fissues, id)
+		if err != nil {
+			return err
+		}
+		if f.IsEmpty() {
+			return fmt.Errorf("Cannot find '%s' in %s", id, t)
+		}
+		e = ExportFissues(f)
+	}
+
+	w := os.Stdout
+	if out != "" {
+		w, err = os.Create(out)
+		if err != nil {
+			return fmt.Errorf("Cannot create file '%s': %v", out, err)
+		}
+		defer w.Close()
+	}
+	return e.Write(w, format)
+}
+
+func readJsonFile(file string) (*jsonql.JSONQL, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read file '%s': %v", file, err)
+	}
+	query, err := jsonql.NewStringQuery(string(bytes))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse file '%s': %v", file, err)
+	}
+	return query, nil
+}
@@ -6,12 +6,23 @@ import (
 )
 
 // Menu
+// Shared by all requests, never modified once built
 type Menu struct {
+	Phases     *NamableList
+	Events     *NamableList
+	Characters *NamableList
+}
+
+// Menu as seen by one request
+type View struct {
+	Menu
 	URI          string
 	IsEssentials bool
-	Phases       *NamableList
-	Events       *NamableList
-	Characters   *NamableList
+	Progress     *Progress   // Nil when reading is not tracked
+	Groups       ComicGroups // Issues behind each first issue, to count what was read and find protagonists
+	Catalog      string      // Name of the catalogue of the page
+	Catalogs     NamableList // All catalogues, ID is the name, the first one is served at '/'
+	Base         string      // Prefix of links, '/c/<name>' when the page is under it
 }
 
 // Get menu
@@ -53,6 +64,12 @@ func ListComics(comics *jsonql.JSONQL) (*ComicList, error) {
 	return FindComicList(comics, "id!=''")
 }
 
+// Including the ones not found in MARVEL API
+func ListAllComics(comics *jsonql.JSONQL) (*ComicList, error) {
+	// HEAVY
+	return FindComicList(comics, "phaseid!=''")
+}
+
 func ListComicsBySortID(comics *jsonql.JSONQL, sortid string) (*ComicList, error) {
 	return FindComicList(comics, "sortid='"+sortid+"'")
 }
@@ -0,0 +1,645 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tealeg/xlsx"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Journal of the run in progress, left in the target folder until it ends
+const foldersJournal = ".folders-journal.json"
+
+// Orphans and mismatched folders are moved here when archiving
+const archiveFolder = "_archive"
+
+// Reconcile modes
+const (
+	ReconcileRename  = "rename"
+	ReconcileFlag    = "flag"
+	ReconcileArchive = "archive"
+)
+
+var ReconcileModes = []string{ReconcileRename, ReconcileFlag, ReconcileArchive}
+
+// Placeholders for folder names
+var folderNameRegexp = regexp.MustCompile(`\{[a-z]*\}`)
+var folderNamePlaceholders = []string{"{code}", "{title}", "{year}"}
+
+// Folder operations
+const (
+	FolderMkdir  = "mkdir"
+	FolderRename = "rename"
+)
+
+type FolderOp struct {
+	Op   string `json:"op"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// Every folder to create or rename, in order
+// Done counts the operations already applied
+type FolderPlan struct {
+	Path   string       `json:"path"`
+	Ops    []FolderOp   `json:"ops"`
+	Done   int          `json:"done"`
+	Report FolderReport `json:"report"`
+}
+
+// Folders not matching the sheet, found when reconciling
+type FolderReport struct {
+	Mismatched []FolderMismatch `json:"mismatched"`
+	Orphans    []FolderOrphan   `json:"orphans"`
+}
+
+type FolderMismatch struct {
+	Folder   string `json:"folder"`
+	Expected string `json:"expected"`
+}
+
+// Files is 0 for orphans safe to delete by hand
+type FolderOrphan struct {
+	Folder string `json:"folder"`
+	Files  int    `json:"files"`
+}
+
+// Name template for second level folders, starting with '{code}'
+// Reconcile is empty, or one of the reconcile modes
+type FolderOptions struct {
+	Template  string
+	Reconcile string
+	DryRun    bool
+}
+
+func (p *FolderPlan) ToJson() ([]byte, error) {
+	return json.MarshalIndent(p, "", "	")
+}
+
+func (p *FolderPlan) IsEmpty() bool {
+	return len(p.Ops) == 0
+}
+
+func (r *FolderReport) ToJson() ([]byte, error) {
+	return json.MarshalIndent(r, "", "	")
+}
+
+func (r *FolderReport) IsEmpty() bool {
+	return len(r.Mismatched) == 0 && len(r.Orphans) == 0
+}
+
+func (opts FolderOptions) Validate() error {
+	if !strings.HasPrefix(opts.Template, "{code}") {
+		return fmt.Errorf("Invalid folder name '%s': must start with {code}", opts.Template)
+	}
+	for _, p := range folderNameRegexp.FindAllString(opts.Template, -1) {
+		known := false
+		for _, e := range folderNamePlaceholders {
+			known = known || e == p
+		}
+		if !known {
+			return fmt.Errorf("Invalid folder name '%s': unknown %s, must be one of %v", opts.Template, p, folderNamePlaceholders)
+		}
+	}
+	if opts.Reconcile == "" {
+		return nil
+	}
+	for _, e := range ReconcileModes {
+		if e == opts.Reconcile {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid reconcile mode '%s': must be one of %v", opts.Reconcile, ReconcileModes)
+}
+
+// Template filled for a title, safe as a folder name
+// Empty '()' or '[]' are dropped when there is no year
+func (opts FolderOptions) folderName(code, title, date string) string {
+	year := date
+	if len(year) > 4 {
+		year = year[:4]
+	}
+	title = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\':
+			return '-'
+		case '<', '>', ':', '"', '|', '?', '*':
+			return -1
+		}
+		return r
+	}, title)
+	name := strings.NewReplacer("{code}", code, "{title}", title, "{year}", year).Replace(opts.Template)
+	name = strings.NewReplacer("()", "", "[]", "").Replace(name)
+	return strings.TrimRight(strings.Join(strings.Fields(name), " "), " .-")
+}
+
+func (o FolderOp) String() string {
+	if o.Op == FolderRename {
+		return fmt.Sprintf("[Renaming folder] From %s to %s", o.From, o.To)
+	}
+	return fmt.Sprintf("[Creating folder] %s", o.To)
+}
+
+// Create folders structure based on XLSX
+// Nothing is touched on a dry run, the plan is only shown
+// Returns what reconciling found, also on a dry run
+func CreateFolders(f, path string, opts FolderOptions) (*FolderReport, error) {
+	journal := filepath.Join(path, foldersJournal)
+	if _, err := os.Stat(journal); err == nil {
+		return nil, fmt.Errorf("[Error] A previous run was interrupted, recover it first (journal '%s')", journal)
+	}
+
+	plan, err := PlanFolders(f, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range plan.Report.Mismatched {
+		fmt.Printf("[Mismatch] %s should be %s\n", m.Folder, m.Expected)
+	}
+	for _, o := range plan.Report.Orphans {
+		fmt.Printf("[Orphan] %s (%v files)\n", o.Folder, o.Files)
+	}
+	if opts.DryRun {
+		for _, o := range plan.Ops {
+			fmt.Println(o)
+		}
+		fmt.Printf("%v folders to create or rename\n", len(plan.Ops))
+		return &plan.Report, nil
+	}
+	return &plan.Report, plan.Execute()
+}
+
+// Folders to create and rename, computed against what is on disk
+func PlanFolders(f, path string, opts FolderOptions) (*FolderPlan, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	// Open file
+	xls, err := xlsx.OpenFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return planFolders(xls, path, opts)
+}
+
+func planFolders(xls *xlsx.File, path string, opts FolderOptions) (*FolderPlan, error) {
+	// Read all folders in path
+	phaseFolders, err := readFolderSet(path, path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &FolderPlan{Path: path, Ops: []FolderOp{}, Report: FolderReport{Mismatched: []FolderMismatch{}, Orphans: []FolderOrphan{}}}
+
+	// Phase folders renamed or reordered in the sheets
+	if opts.Reconcile != "" {
+		expected := map[int]string{}
+		for sheet_i, sheet := range xls.Sheets {
+			starter, err := getCode(sheet_i + 1)
+			if err != nil {
+				return nil, err
+			}
+			expected[sheet_i+1] = fmt.Sprintf("%v - %s", starter, sheet.Name)
+		}
+		plan.reconcile(phaseFolders, expected, opts.Reconcile)
+	}
+
+	// Loop through file sheets
+	for sheet_i, sheet := range xls.Sheets {
+		// Get starter code
+		starter, err := getCode(sheet_i + 1)
+		if err != nil {
+			return nil, err
+		}
+		// Find folder, create it if it doesn't exist
+		phaseFolderName := fmt.Sprintf("%v - %s", starter, sheet.Name)
+		phaseFolderNameFull := filepath.Join(path, phaseFolderName)
+		folders := &folderSet{parent: phaseFolderNameFull, names: map[string]string{}}
+		if phaseFolders.has(phaseFolderName) {
+			folders, err = readFolderSet(phaseFolderNameFull, phaseFolders.diskPath(phaseFolderName))
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			phaseFolders.mkdir(plan, phaseFolderName)
+		}
+
+		// Loop throw rows to check second level folders
+		// Folder names by sortid, from the first row of each title
+		expected := map[int]string{}
+		rows, err := readSheet(sheet)
+		if err != nil {
+			return nil, err
+		}
+		sortID := 0
+		for _, r := range rows {
+			if r.New {
+				fmt.Printf("[New comic found] %s %v %v\n", r.Collection, r.Vol, r.Num)
+			}
+			if !r.NewTitle {
+				continue
+			}
+			sortID = r.SortID
+			// Get code
+			code, err := getCode(sortID)
+			if err != nil {
+				return nil, err
+			}
+			expected[sortID] = opts.folderName(code, r.Title, r.Date)
+			// A folder already named after the new title was made by a previous run
+			// Only the title tells, names with just the code always make room
+			if r.New && folders.hasCode(sortID) && (expected[sortID] == code || !folders.has(expected[sortID])) {
+				// Make room moving every folder from 'sortID' one code up, last first
+				for _, name := range folders.from(sortID) {
+					newCode, err := getCode(folderCode(name) + 1)
+					if err != nil {
+						return nil, err
+					}
+					folders.rename(plan, name, newCode+name[len(code):])
+				}
+			}
+		}
+
+		// Titles renamed, reordered or removed in the sheet
+		if opts.Reconcile != "" {
+			plan.reconcile(folders, expected, opts.Reconcile)
+		}
+
+		// Create folders that don't exist
+		for i := 1; i <= sortID; i++ {
+			if !folders.hasCode(i) {
+				folders.mkdir(plan, expected[i])
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// Match folders to the names expected for their code
+// Folders carrying the title of another code were reordered and move there
+// Folders with the right code and a wrong title are renamed, only flagged or archived
+// Folders with no code in the sheet are orphans, archived or only reported
+// Nothing is ever deleted
+func (p *FolderPlan) reconcile(folders *folderSet, expected map[int]string, mode string) {
+	names := folders.sorted()
+	done := map[int]bool{}
+	pending := map[string]bool{}
+	for _, name := range names {
+		c := folderCode(name)
+		if c >= 0 && expected[c] == name {
+			done[c] = true
+		} else if name != archiveFolder {
+			pending[name] = true
+		}
+	}
+
+	// Titles in the sheet, first code wins
+	// Names with just the code have no title to match
+	titles := map[string]int{}
+	for c, name := range expected {
+		if len(name) <= 3 {
+			continue
+		}
+		if other, exists := titles[name[3:]]; !exists || c < other {
+			titles[name[3:]] = c
+		}
+	}
+
+	resolve := func(name string, c int, mode string) {
+		delete(pending, name)
+		done[c] = true
+		p.Report.Mismatched = append(p.Report.Mismatched, FolderMismatch{
+			Folder:   filepath.Join(folders.parent, name),
+			Expected: filepath.Join(folders.parent, expected[c]),
+		})
+		switch mode {
+		case ReconcileRename:
+			folders.rename(p, name, expected[c])
+		case ReconcileArchive:
+			folders.archive(p, name)
+		}
+	}
+
+	// Reordered, archiving would lose a title the sheet still has
+	for _, name := range names {
+		c := folderCode(name)
+		if !pending[name] || c < 0 || len(name) <= 3 {
+			continue
+		}
+		if k, exists := titles[name[3:]]; exists && k != c && !done[k] {
+			if mode == ReconcileArchive {
+				resolve(name, k, ReconcileRename)
+			} else {
+				resolve(name, k, mode)
+			}
+		}
+	}
+	// Wrong title
+	for _, name := range names {
+		c := folderCode(name)
+		if pending[name] && c >= 0 && expected[c] != "" && !done[c] {
+			resolve(name, c, mode)
+		}
+	}
+	// Orphans
+	for _, name := range names {
+		if !pending[name] {
+			continue
+		}
+		orphan := FolderOrphan{Folder: filepath.Join(folders.parent, name)}
+		orphan.Files, _ = countFiles(folders.diskPath(name))
+		p.Report.Orphans = append(p.Report.Orphans, orphan)
+		if mode == ReconcileArchive {
+			folders.archive(p, name)
+		}
+	}
+}
+
+// Apply the plan, undoing what was done if any step fails
+// The journal on disk lets RecoverFolders undo it after a crash
+func (p *FolderPlan) Execute() error {
+	if p.IsEmpty() {
+		return nil
+	}
+	journal := filepath.Join(p.Path, foldersJournal)
+	err := p.save()
+	if err != nil {
+		return err
+	}
+	for p.Done < len(p.Ops) {
+		o := p.Ops[p.Done]
+		fmt.Println(o)
+		err = o.apply()
+		if err == nil {
+			p.Done++
+			err = p.save()
+		}
+		if err != nil {
+			errRollback := p.rollback()
+			if errRollback != nil {
+				return fmt.Errorf("%v\n[Error] Cannot roll back, see journal '%s': %v", err, journal, errRollback)
+			}
+			return fmt.Errorf("%v\nRolled back, nothing changed", err)
+		}
+	}
+	err = os.Remove(journal)
+	if err != nil {
+		return fmt.Errorf("Cannot remove journal '%s': %v", journal, err)
+	}
+	return nil
+}
+
+// Undo an interrupted run, reading its journal
+func RecoverFolders(path string) error {
+	journal := filepath.Join(path, foldersJournal)
+	bytes, err := ioutil.ReadFile(journal)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Nothing to recover, there is no journal '%s'", journal)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot read journal '%s': %v", journal, err)
+	}
+	p := &FolderPlan{}
+	err = json.Unmarshal(bytes, p)
+	if err != nil {
+		return fmt.Errorf("Cannot parse journal '%s': %v", journal, err)
+	}
+	// The step running when interrupted may be applied but not journaled
+	if p.Done < len(p.Ops) && p.Ops[p.Done].applied() {
+		p.Done++
+	}
+	err = p.rollback()
+	if err != nil {
+		return err
+	}
+	return os.Remove(journal)
+}
+
+func (p *FolderPlan) rollback() error {
+	for p.Done > 0 {
+		o := p.Ops[p.Done-1]
+		fmt.Printf("[Undoing] %s\n", o)
+		err := o.undo()
+		if err != nil {
+			return err
+		}
+		p.Done--
+		err = p.save()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write aside and rename, so a crash never leaves half a journal
+func (p *FolderPlan) save() error {
+	bytes, err := p.ToJson()
+	if err != nil {
+		return err
+	}
+	journal := filepath.Join(p.Path, foldersJournal)
+	tmp := fmt.Sprintf("%s.tmp", journal)
+	err = ioutil.WriteFile(tmp, bytes, 0644)
+	if err != nil {
+		return fmt.Errorf("Cannot write journal '%s': %v", tmp, err)
+	}
+	err = os.Rename(tmp, journal)
+	if err != nil {
+		return fmt.Errorf("Cannot write journal '%s': %v", journal, err)
+	}
+	return nil
+}
+
+func (o FolderOp) apply() error {
+	var err error
+	switch o.Op {
+	case FolderMkdir:
+		err = os.Mkdir(o.To, 0755)
+	case FolderRename:
+		// Never overwrite, os.Rename would replace an empty folder
+		if _, errStat := os.Stat(o.To); errStat == nil {
+			return fmt.Errorf("[Error] Cannot rename '%s', '%s' already exists", o.From, o.To)
+		}
+		err = os.Rename(o.From, o.To)
+	default:
+		return fmt.Errorf("[Error] Unknown operation '%s'", o.Op)
+	}
+	if err != nil {
+		return fmt.Errorf("[Error] %v", err)
+	}
+	return nil
+}
+
+func (o FolderOp) undo() error {
+	var err error
+	switch o.Op {
+	case FolderMkdir:
+		// Only empty folders, files put there since are kept
+		err = os.Remove(o.To)
+	case FolderRename:
+		err = os.Rename(o.To, o.From)
+	}
+	if err != nil {
+		return fmt.Errorf("[Error] Cannot undo: %v", err)
+	}
+	return nil
+}
+
+func (o FolderOp) applied() bool {
+	_, errTo := os.Stat(o.To)
+	if o.Op == FolderRename {
+		_, errFrom := os.Stat(o.From)
+		return errTo == nil && os.IsNotExist(errFrom)
+	}
+	return errTo == nil
+}
+
+func (p *FolderPlan) add(o FolderOp) {
+	p.Ops = append(p.Ops, o)
+}
+
+// Folders in parent as they will be once the plan runs
+// Each name maps to the path it has on disk now, empty for new folders
+type folderSet struct {
+	parent string
+	names  map[string]string
+}
+
+// Folders in disk, to be found in parent
+func readFolderSet(parent, disk string) (*folderSet, error) {
+	files, err := ioutil.ReadDir(disk)
+	if err != nil {
+		return nil, err
+	}
+	folders := &folderSet{parent: parent, names: map[string]string{}}
+	for _, file := range files {
+		if file.IsDir() {
+			folders.names[file.Name()] = filepath.Join(disk, file.Name())
+		}
+	}
+	return folders, nil
+}
+
+func (s *folderSet) has(name string) bool {
+	_, exists := s.names[name]
+	return exists
+}
+
+func (s *folderSet) diskPath(name string) string {
+	return s.names[name]
+}
+
+func (s *folderSet) mkdir(p *FolderPlan, name string) {
+	p.add(FolderOp{Op: FolderMkdir, To: filepath.Join(s.parent, name)})
+	s.names[name] = ""
+}
+
+func (s *folderSet) rename(p *FolderPlan, from, to string) {
+	p.add(FolderOp{Op: FolderRename, From: filepath.Join(s.parent, from), To: filepath.Join(s.parent, to)})
+	s.names[to] = s.names[from]
+	delete(s.names, from)
+}
+
+// Move into the archive folder, with a free name
+func (s *folderSet) archive(p *FolderPlan, name string) {
+	if !s.has(archiveFolder) {
+		s.mkdir(p, archiveFolder)
+	}
+	to := name
+	for n := 2; s.archived(p, to); n++ {
+		to = fmt.Sprintf("%s (%v)", name, n)
+	}
+	p.add(FolderOp{Op: FolderRename, From: filepath.Join(s.parent, name), To: filepath.Join(s.parent, archiveFolder, to)})
+	delete(s.names, name)
+}
+
+// Already in the archive folder, or going to be
+func (s *folderSet) archived(p *FolderPlan, name string) bool {
+	for _, o := range p.Ops {
+		if o.To == filepath.Join(s.parent, archiveFolder, name) {
+			return true
+		}
+	}
+	if disk := s.diskPath(archiveFolder); disk != "" {
+		_, err := os.Stat(filepath.Join(disk, name))
+		return err == nil
+	}
+	return false
+}
+
+func (s *folderSet) sorted() []string {
+	names := []string{}
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *folderSet) hasCode(sortID int) bool {
+	for name := range s.names {
+		if folderCode(name) == sortID {
+			return true
+		}
+	}
+	return false
+}
+
+// Folders with a code from 'sortID' on, highest code first
+func (s *folderSet) from(sortID int) []string {
+	names := []string{}
+	for name := range s.names {
+		if folderCode(name) >= sortID {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := folderCode(names[i]), folderCode(names[j])
+		if ci != cj {
+			return ci > cj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Files under path, for orphans still on disk
+func countFiles(path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+	n := 0
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Code a folder name starts with ('007' or '007 - Title'), -1 if none
+func folderCode(name string) int {
+	if len(name) < 3 || (len(name) > 3 && name[3] >= '0' && name[3] <= '9') {
+		return -1
+	}
+	code := 0
+	for _, r := range name[:3] {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		code = code*10 + int(r-'0')
+	}
+	return code
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"github.com/tealeg/xlsx"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// One sheet, rows as id, collection, vol, num, title and date
+// Other mandatory columns are left empty
+func workbook(name string, rows ...[]string) *xlsx.File {
+	f := xlsx.NewFile()
+	sheet, _ := f.AddSheet(name)
+	for _, r := range append([][]string{{"ID", "Collection", "Vol", "Num", "Title", "Date"}}, rows...) {
+		row := sheet.AddRow()
+		for _, v := range r {
+			row.AddCell().SetString(v)
+		}
+		for i := len(r); i < mandatory_cols; i++ {
+			row.AddCell()
+		}
+	}
+	return f
+}
+
+// Phase folder with these title folders in a temporary path
+func phaseFolders(t *testing.T, names ...string) string {
+	path, err := ioutil.TempDir("", "folders")
+	if err != nil {
+		t.Fatalf("Cannot create temporary folder: %v", err)
+	}
+	for _, name := range names {
+		err = os.MkdirAll(filepath.Join(path, "001 - Phase", name), 0755)
+		if err != nil {
+			t.Fatalf("Cannot create folder: %v", err)
+		}
+	}
+	return path
+}
+
+func folderOps(p *FolderPlan, path string) []string {
+	ops := []string{}
+	for _, o := range p.Ops {
+		from, _ := filepath.Rel(path, o.From)
+		to, _ := filepath.Rel(path, o.To)
+		if o.Op == FolderMkdir {
+			ops = append(ops, "mkdir "+to)
+		} else {
+			ops = append(ops, "rename "+from+" "+to)
+		}
+	}
+	return ops
+}
+
+func TestPlanFolders(t *testing.T) {
+	inserted := workbook("Phase",
+		[]string{"1", "Siege", "1", "1", "Siege", "2010-03-01"},
+		[]string{"", "Thor", "1", "1", "Thor", "2010-04-01"},
+		[]string{"2", "Avengers", "4", "1", "Avengers", "2010-05-01"},
+	)
+	existing := workbook("Phase",
+		[]string{"1", "Siege", "1", "1", "Siege", "2010-03-01"},
+		[]string{"3", "Thor", "1", "1", "Thor", "2010-04-01"},
+		[]string{"2", "Avengers", "4", "1", "Avengers", "2010-05-01"},
+	)
+	// Numbered as the JSON generator does: point ones are issues, rows with no collection are not
+	fractional := workbook("Phase",
+		[]string{"1", "Siege", "1", "1", "Siege", "2010-03-01"},
+		[]string{"4", "Siege", "1", "1.5", "Siege", "2010-03-15"},
+		[]string{"", "", "", "", "", ""},
+		[]string{"", "Thor", "1", "1", "Thor", "2010-04-01"},
+		[]string{"2", "Avengers", "4", "1", "Avengers", "2010-05-01"},
+	)
+	tests := []struct {
+		name    string
+		xls     *xlsx.File
+		folders []string
+		opts    FolderOptions
+		want    []string
+	}{
+		{"nothing to do", existing, []string{"001", "002", "003"}, FolderOptions{Template: "{code}"}, []string{}},
+		{"inserted with code", inserted, []string{"001", "002"}, FolderOptions{Template: "{code}"},
+			[]string{"rename 001 - Phase/002 001 - Phase/003", "mkdir 001 - Phase/002"}},
+		{"inserted with title", inserted, []string{"001 - Siege", "002 - Avengers"}, FolderOptions{Template: "{code} - {title}"},
+			[]string{"rename 001 - Phase/002 - Avengers 001 - Phase/003 - Avengers", "mkdir 001 - Phase/002 - Thor"}},
+		{"point ones and empty rows", fractional, []string{"001 - Siege", "002 - Avengers"}, FolderOptions{Template: "{code} - {title}"},
+			[]string{"rename 001 - Phase/002 - Avengers 001 - Phase/003 - Avengers", "mkdir 001 - Phase/002 - Thor"}},
+		{"inserted by a previous run", inserted, []string{"001 - Siege", "002 - Thor", "003 - Avengers"}, FolderOptions{Template: "{code} - {title}"},
+			[]string{}},
+		{"code orphans stay", existing, []string{"002", "003", "007"}, FolderOptions{Template: "{code}", Reconcile: ReconcileRename},
+			[]string{"mkdir 001 - Phase/001"}},
+		{"reordered titles", existing, []string{"001 - Siege", "002 - Avengers", "003 - Thor"}, FolderOptions{Template: "{code} - {title}", Reconcile: ReconcileRename},
+			[]string{"rename 001 - Phase/002 - Avengers 001 - Phase/003 - Avengers", "rename 001 - Phase/003 - Thor 001 - Phase/002 - Thor"}},
+	}
+	for _, e := range tests {
+		path := phaseFolders(t, e.folders...)
+		defer os.RemoveAll(path)
+		p, err := planFolders(e.xls, path, e.opts)
+		if err != nil {
+			t.Errorf("%s: cannot plan folders: %v", e.name, err)
+			continue
+		}
+		got := folderOps(p, path)
+		if !reflect.DeepEqual(got, e.want) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.want, got)
+		}
+	}
+}
+
+func TestPlanFoldersOrphans(t *testing.T) {
+	path := phaseFolders(t, "001", "002", "007")
+	defer os.RemoveAll(path)
+	xls := workbook("Phase",
+		[]string{"1", "Siege", "1", "1", "Siege", "2010-03-01"},
+		[]string{"2", "Thor", "1", "1", "Thor", "2010-04-01"},
+		[]string{"3", "Avengers", "4", "1", "Avengers", "2010-05-01"},
+	)
+	p, err := planFolders(xls, path, FolderOptions{Template: "{code}", Reconcile: ReconcileFlag})
+	if err != nil {
+		t.Fatalf("Cannot plan folders: %v", err)
+	}
+	want := []string{"mkdir 001 - Phase/003"}
+	if got := folderOps(p, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if len(p.Report.Orphans) != 1 || filepath.Base(p.Report.Orphans[0].Folder) != "007" {
+		t.Errorf("Expected orphan 007, got %v", p.Report.Orphans)
+	}
+}
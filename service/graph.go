@@ -0,0 +1,337 @@
+package service
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+)
+
+// Graph formats
+const (
+	GraphJSON    = "json"
+	GraphGraphML = "graphml"
+	GraphGEXF    = "gexf"
+)
+
+var GraphFormats = []string{GraphJSON, GraphGraphML, GraphGEXF}
+
+// Node and edge types
+const (
+	GraphCharacter = "character"
+	GraphCreator   = "creator"
+)
+
+// Characters, and creators if asked, linked by the issues they share
+// Same node-link layout as d3 or networkx
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Links []GraphLink `json:"links"`
+}
+
+type GraphNode struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Type   string `json:"type"`
+	Issues int    `json:"issues"`
+}
+
+// Undirected, weight is the number of issues together
+type GraphLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	Weight int    `json:"weight"`
+}
+
+// Comics in the graph, as in the comics list, and if creators go in
+type GraphQuery struct {
+	ListQuery
+	Creators bool
+	Format   string
+}
+
+func (g *Graph) ToJson() ([]byte, error) {
+	return json.MarshalIndent(g, "", "	")
+}
+
+func (g *Graph) IsEmpty() bool {
+	return len(g.Nodes) == 0
+}
+
+func NewGraphQuery(v url.Values) (GraphQuery, error) {
+	l, err := NewListQuery(v)
+	if err != nil {
+		return GraphQuery{}, err
+	}
+	q := GraphQuery{ListQuery: l, Format: GraphJSON}
+	if s := v.Get("creators"); s != "" {
+		q.Creators, err = strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("Invalid creators '%s': must be true or false", s)
+		}
+	}
+	if s := v.Get("format"); s != "" {
+		q.Format = s
+	}
+	return q, ValidateGraphFormat(q.Format)
+}
+
+func ValidateGraphFormat(format string) error {
+	for _, e := range GraphFormats {
+		if e == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid format '%s': must be one of %v", format, GraphFormats)
+}
+
+func GraphContentType(format string) string {
+	switch format {
+	case GraphGraphML, GraphGEXF:
+		return "application/xml; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// Co-appearances between the characters of each matching comic
+// Nodes and links in reading order of their first issue
+func BuildGraph(comics *ComicList, q GraphQuery) *Graph {
+	b := graphBuilder{
+		graph: Graph{Nodes: []GraphNode{}, Links: []GraphLink{}},
+		nodes: make(map[string]int),
+		links: make(map[string]int),
+	}
+	for _, c := range *comics {
+		if !q.Match(&c) {
+			continue
+		}
+		characters := []string{}
+		for _, e := range c.Characters {
+			characters = append(characters, b.node(GraphCharacter, e))
+		}
+		for i, source := range characters {
+			for _, target := range characters[i+1:] {
+				b.link(GraphCharacter, source, target)
+			}
+		}
+		if !q.Creators {
+			continue
+		}
+		for _, e := range c.Creators {
+			creator := b.node(GraphCreator, Namable{ID: e.ID, Name: e.Name})
+			for _, target := range characters {
+				b.link(GraphCreator, creator, target)
+			}
+		}
+	}
+	return &b.graph
+}
+
+type graphBuilder struct {
+	graph Graph
+	nodes map[string]int
+	links map[string]int
+}
+
+// Characters and creators have their own codes
+func (b *graphBuilder) node(t string, n Namable) string {
+	id := fmt.Sprintf("%s-%s", t, n.ID)
+	i, exists := b.nodes[id]
+	if !exists {
+		i = len(b.graph.Nodes)
+		b.nodes[id] = i
+		b.graph.Nodes = append(b.graph.Nodes, GraphNode{ID: id, Label: n.Name, Type: t})
+	}
+	b.graph.Nodes[i].Issues++
+	return id
+}
+
+func (b *graphBuilder) link(t, source, target string) {
+	if source == target {
+		return
+	}
+	if source > target && t == GraphCharacter {
+		source, target = target, source
+	}
+	k := fmt.Sprintf("%s|%s", source, target)
+	i, exists := b.links[k]
+	if !exists {
+		i = len(b.graph.Links)
+		b.links[k] = i
+		b.graph.Links = append(b.graph.Links, GraphLink{Source: source, Target: target, Type: t})
+	}
+	b.graph.Links[i].Weight++
+}
+
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case GraphJSON:
+		bytes, err := g.ToJson()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes)
+		return err
+	case GraphGraphML:
+		return writeXml(w, g.graphML())
+	case GraphGEXF:
+		return writeXml(w, g.gexf())
+	}
+	return ValidateGraphFormat(format)
+}
+
+func writeXml(w io.Writer, v interface{}) error {
+	bytes, err := xml.MarshalIndent(v, "", "	")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, bytes)
+	return err
+}
+
+// GraphML, as read by Gephi, yEd or Cytoscape
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (g *Graph) graphML() *graphML {
+	x := &graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "type", For: "node", Name: "type", Type: "string"},
+			{ID: "issues", For: "node", Name: "issues", Type: "int"},
+			{ID: "linktype", For: "edge", Name: "type", Type: "string"},
+			{ID: "weight", For: "edge", Name: "weight", Type: "int"},
+		},
+		Graph: graphMLGraph{ID: "comics", EdgeDefault: "undirected"},
+	}
+	for _, n := range g.Nodes {
+		x.Graph.Nodes = append(x.Graph.Nodes, graphMLNode{ID: n.ID, Data: []graphMLData{
+			{Key: "label", Value: n.Label},
+			{Key: "type", Value: n.Type},
+			{Key: "issues", Value: strconv.Itoa(n.Issues)},
+		}})
+	}
+	for _, l := range g.Links {
+		x.Graph.Edges = append(x.Graph.Edges, graphMLEdge{Source: l.Source, Target: l.Target, Data: []graphMLData{
+			{Key: "linktype", Value: l.Type},
+			{Key: "weight", Value: strconv.Itoa(l.Weight)},
+		}})
+	}
+	return x
+}
+
+// GEXF 1.2, as read by Gephi
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	Mode            string               `xml:"mode,attr"`
+	DefaultEdgeType string               `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributeClass `xml:"attributes"`
+	Nodes           []gexfNode           `xml:"nodes>node"`
+	Edges           []gexfEdge           `xml:"edges>edge"`
+}
+
+type gexfAttributeClass struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID     string      `xml:"id,attr"`
+	Label  string      `xml:"label,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID     string      `xml:"id,attr"`
+	Source string      `xml:"source,attr"`
+	Target string      `xml:"target,attr"`
+	Weight int         `xml:"weight,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func (g *Graph) gexf() *gexf {
+	x := &gexf{
+		Xmlns:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Graph: gexfGraph{
+			Mode:            "static",
+			DefaultEdgeType: "undirected",
+			Attributes: []gexfAttributeClass{
+				{Class: "node", Attributes: []gexfAttribute{
+					{ID: "type", Title: "type", Type: "string"},
+					{ID: "issues", Title: "issues", Type: "integer"},
+				}},
+				{Class: "edge", Attributes: []gexfAttribute{
+					{ID: "type", Title: "type", Type: "string"},
+				}},
+			},
+		},
+	}
+	for _, n := range g.Nodes {
+		x.Graph.Nodes = append(x.Graph.Nodes, gexfNode{ID: n.ID, Label: n.Label, Values: []gexfValue{
+			{For: "type", Value: n.Type},
+			{For: "issues", Value: strconv.Itoa(n.Issues)},
+		}})
+	}
+	for i, l := range g.Links {
+		x.Graph.Edges = append(x.Graph.Edges, gexfEdge{ID: strconv.Itoa(i), Source: l.Source, Target: l.Target, Weight: l.Weight, Values: []gexfValue{
+			{For: "type", Value: l.Type},
+		}})
+	}
+	return x
+}
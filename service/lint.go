@@ -0,0 +1,343 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tealeg/xlsx"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lint checks
+const (
+	LintDuplicate   = "duplicate"   // Same issue twice
+	LintGap         = "gap"         // Missing numbers of a collection within a title
+	LintEvent       = "event"       // Event split by other titles
+	LintCharacter   = "character"   // Character in a single issue, likely a typo
+	LintDate        = "date"        // Date going backwards in reading order
+	LintProtagonist = "protagonist" // Protagonist of an essential title, not essential anywhere else
+)
+
+// Months a date can go backwards before it is flagged
+const DefaultLintMonths = 12
+
+// Problem found, sheet and row only when read from the XLSX
+type LintProblem struct {
+	Check   string `json:"check"`
+	PhaseID string `json:"phaseid"`
+	SortID  string `json:"sortid"`
+	Sheet   string `json:"sheet,omitempty"`
+	Row     int    `json:"row,omitempty"`
+	Message string `json:"message"`
+}
+
+type LintReport struct {
+	Source   string        `json:"source"`
+	Issues   int           `json:"issues"`
+	Problems []LintProblem `json:"problems"`
+}
+
+type LintOptions struct {
+	Months int
+}
+
+// Comic and where it is in the XLSX
+type lintRow struct {
+	Comic
+	Sheet string
+	Row   int
+}
+
+func (r *LintReport) ToJson() ([]byte, error) {
+	return json.MarshalIndent(r, "", "	")
+}
+
+func (r *LintReport) IsEmpty() bool {
+	return len(r.Problems) == 0
+}
+
+func (p LintProblem) String() string {
+	if p.Sheet != "" {
+		return fmt.Sprintf("[%s] '%s' row %v: %s", p.Check, p.Sheet, p.Row, p.Message)
+	}
+	return fmt.Sprintf("[%s] %s - %s: %s", p.Check, p.PhaseID, p.SortID, p.Message)
+}
+
+// Lint the XLSX if there is one, the generated comics.json otherwise
+func LintFile(f, data string, opts LintOptions) (*LintReport, error) {
+	var rows []lintRow
+	source := f
+	if f != "" {
+		xls, err := xlsx.OpenFile(f)
+		if err != nil {
+			return nil, err
+		}
+		rows, err = readLintRows(xls)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		source = fmt.Sprintf("%s/comics.json", data)
+		all, err := readJsonFile(source)
+		if err != nil {
+			return nil, err
+		}
+		comics, err := ListAllComics(all)
+		if err != nil {
+			return nil, err
+		}
+		l := append(ComicList{}, *comics...)
+		less, _ := comicSorter(l, "order")
+		sort.SliceStable(l, less)
+		for _, c := range l {
+			rows = append(rows, lintRow{Comic: c})
+		}
+	}
+	report := lint(rows, opts)
+	report.Source = source
+	return report, nil
+}
+
+// Rows read as the JSON generator does, so phases and sortids match
+// Characters and creators only have names
+func readLintRows(xls *xlsx.File) ([]lintRow, error) {
+	rows := []lintRow{}
+	for sheet_i, sheet := range xls.Sheets {
+		phaseID, err := getCode(sheet_i + 1)
+		if err != nil {
+			return nil, err
+		}
+		sheetRows, err := readSheet(sheet)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range sheetRows {
+			c := Comic{
+				PhaseID:    phaseID,
+				PhaseName:  sheet.Name,
+				Collection: r.Collection,
+				Vol:        r.Vol,
+				Num:        r.Num,
+				Title:      r.Title,
+				Date:       r.Date,
+				Event:      r.Event,
+				Essential:  r.Essential,
+			}
+			for _, ch := range strings.Split(r.Characters, ", ") {
+				if ch != "" {
+					c.Characters = append(c.Characters, Namable{Name: ch})
+				}
+			}
+			if r.Protagonist != "" {
+				c.Protagonist = &Namable{Name: r.Protagonist}
+			}
+			c.SortID, err = getCode(r.SortID)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, lintRow{Comic: c, Sheet: sheet.Name, Row: r.Line})
+		}
+	}
+	return rows, nil
+}
+
+// All checks over rows in reading order
+func lint(rows []lintRow, opts LintOptions) *LintReport {
+	if opts.Months <= 0 {
+		opts.Months = DefaultLintMonths
+	}
+	report := &LintReport{Issues: len(rows), Problems: []LintProblem{}}
+	add := func(check string, r lintRow, format string, a ...interface{}) {
+		report.Problems = append(report.Problems, LintProblem{
+			Check:   check,
+			PhaseID: r.PhaseID,
+			SortID:  r.SortID,
+			Sheet:   r.Sheet,
+			Row:     r.Row,
+			Message: fmt.Sprintf(format, a...),
+		})
+	}
+	lintDuplicates(rows, add)
+	lintGaps(rows, add)
+	lintEvents(rows, add)
+	lintCharacters(rows, add)
+	lintDates(rows, opts.Months, add)
+	lintProtagonists(rows, add)
+	return report
+}
+
+type lintAdd func(check string, r lintRow, format string, a ...interface{})
+
+func (r lintRow) issue() string {
+	return IssueRange{Collection: r.Collection, Vol: r.Vol, From: r.Num, To: r.Num}.String()
+}
+
+func (r lintRow) where() string {
+	if r.Sheet != "" {
+		return fmt.Sprintf("'%s' row %v", r.Sheet, r.Row)
+	}
+	return fmt.Sprintf("%s - %s", r.PhaseID, r.SortID)
+}
+
+func lintDuplicates(rows []lintRow, add lintAdd) {
+	seen := make(map[string]lintRow)
+	for _, r := range rows {
+		k := issueKey(r.Collection, r.Vol, r.Num)
+		if first, exists := seen[k]; exists {
+			add(LintDuplicate, r, "%s already in %s", r.issue(), first.where())
+			continue
+		}
+		seen[k] = r
+	}
+}
+
+// Only whole numbers, as point ones and annuals by year are not a series
+func lintGaps(rows []lintRow, add lintAdd) {
+	for i := 0; i < len(rows); {
+		j := i
+		nums := make(map[string][]float64)
+		first := make(map[string]lintRow)
+		order := []string{}
+		for ; j < len(rows) && rows[j].PhaseID == rows[i].PhaseID && rows[j].SortID == rows[i].SortID; j++ {
+			r := rows[j]
+			if r.Num != math.Trunc(r.Num) || r.Num > 999 {
+				continue
+			}
+			k := issueKey(r.Collection, r.Vol, 0)
+			if _, exists := first[k]; !exists {
+				first[k] = r
+				order = append(order, k)
+			}
+			nums[k] = append(nums[k], r.Num)
+		}
+		for _, k := range order {
+			l := nums[k]
+			sort.Float64s(l)
+			for n := 1; n < len(l); n++ {
+				if l[n]-l[n-1] > 1 {
+					add(LintGap, first[k], "%s vol. %v goes from #%v to #%v", first[k].Collection, first[k].Vol, l[n-1], l[n])
+				}
+			}
+		}
+		i = j
+	}
+}
+
+// Titles of an event should follow each other
+func lintEvents(rows []lintRow, add lintAdd) {
+	last := make(map[string]int) // Index of the last title of each event
+	title := -1
+	for i, r := range rows {
+		if i == 0 || r.PhaseID != rows[i-1].PhaseID || r.SortID != rows[i-1].SortID {
+			title++
+		}
+		if r.Event == "" {
+			continue
+		}
+		if t, exists := last[r.Event]; exists && t < title-1 {
+			add(LintEvent, r, "Event '%s' comes back after %v titles without it", r.Event, title-t-1)
+		}
+		last[r.Event] = title
+	}
+}
+
+func lintCharacters(rows []lintRow, add lintAdd) {
+	count := make(map[string]int)
+	for _, r := range rows {
+		for _, ch := range r.Characters {
+			if ch.Name != "" {
+				count[ch.Name]++
+			}
+		}
+	}
+	for _, r := range rows {
+		for _, ch := range r.Characters {
+			if count[ch.Name] == 1 {
+				add(LintCharacter, r, "Character '%s' only appears in %s", ch.Name, r.issue())
+			}
+		}
+	}
+}
+
+// Against the previous dated row
+func lintDates(rows []lintRow, months int, add lintAdd) {
+	prev := -1
+	for i, r := range rows {
+		m := lintMonth(r.Date)
+		if m == 0 {
+			continue
+		}
+		if prev >= 0 {
+			if back := lintMonth(rows[prev].Date) - m; back > months {
+				add(LintDate, r, "%s is dated %s, %v months before %s in %s", r.issue(), r.Date, back, rows[prev].issue(), rows[prev].where())
+			}
+		}
+		prev = i
+	}
+}
+
+// Months since year 0 of a 'YYYY-MM-DD' date, 0 if unknown
+func lintMonth(date string) int {
+	if len(date) < 7 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	month, err := strconv.Atoi(date[5:7])
+	if err != nil {
+		return 0
+	}
+	return year*12 + month
+}
+
+// Protagonist chosen as the JSON generator does
+func lintProtagonists(rows []lintRow, add lintAdd) {
+	essentials := make(map[string]map[string]bool) // Essential titles of each character
+	type title struct {
+		row         lintRow
+		issues      ComicList
+		name        string // From the protagonist column
+		protagonist string
+	}
+	titles := []title{}
+	for i, r := range rows {
+		key := groupKey(r.PhaseID, r.SortID)
+		if i == 0 || key != groupKey(rows[i-1].PhaseID, rows[i-1].SortID) {
+			titles = append(titles, title{row: r})
+		}
+		t := &titles[len(titles)-1]
+		t.issues = append(t.issues, r.Comic)
+		if t.name == "" && r.Protagonist != nil {
+			t.name = r.Protagonist.Name
+		}
+		if !r.Essential {
+			continue
+		}
+		for _, ch := range r.Characters {
+			if essentials[ch.Name] == nil {
+				essentials[ch.Name] = make(map[string]bool)
+			}
+			essentials[ch.Name][key] = true
+		}
+	}
+	for _, t := range titles {
+		if p, found := GetProtagonist(t.row.Title, t.issues, t.name); found {
+			t.protagonist = p.Name
+		}
+		if !t.row.Essential || t.protagonist == "" {
+			continue
+		}
+		key := groupKey(t.row.PhaseID, t.row.SortID)
+		others := len(essentials[t.protagonist])
+		if essentials[t.protagonist][key] {
+			others--
+		}
+		if others == 0 {
+			add(LintProtagonist, t.row, "Protagonist '%s' of essential '%s' is in no other essential title", t.protagonist, t.row.Title)
+		}
+	}
+}
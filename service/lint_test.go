@@ -0,0 +1,93 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Issue of a title in phase 001, the collection being the title
+func lintIssue(sortID, title string, num float64, date string) lintRow {
+	return lintRow{Comic: Comic{PhaseID: "001", SortID: sortID, Collection: title, Vol: 1, Num: num, Title: title, Date: date}}
+}
+
+func inEvent(r lintRow, event string) lintRow {
+	r.Event = event
+	return r
+}
+
+func essential(r lintRow, names ...string) lintRow {
+	r.Essential = true
+	for _, n := range names {
+		r.Characters = append(r.Characters, Namable{Name: n})
+	}
+	return r
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   []lintRow
+		months int
+		want   []string
+	}{
+		{"empty", []lintRow{}, 0, []string{}},
+		{"clean", []lintRow{lintIssue("001", "X-Men", 1, "2000-01-01"), lintIssue("001", "X-Men", 2, "2000-02-01")}, 0, []string{}},
+		{"duplicate", []lintRow{lintIssue("001", "X-Men", 1, ""), lintIssue("002", "Wolverine", 1, ""), lintIssue("003", "X-Men", 1, "")}, 0,
+			[]string{"[duplicate] 001 - 003: X-Men vol. 1 #1 already in 001 - 001"}},
+		{"gap", []lintRow{lintIssue("001", "X-Men", 1, ""), lintIssue("001", "X-Men", 2, ""), lintIssue("001", "X-Men", 5, "")}, 0,
+			[]string{"[gap] 001 - 001: X-Men vol. 1 goes from #2 to #5"}},
+		{"gap skips point ones and annuals", []lintRow{lintIssue("001", "X-Men", 0.1, ""), lintIssue("001", "X-Men", 1, ""), lintIssue("001", "X-Men", 2, ""), lintIssue("001", "X-Men", 1998, "")}, 0,
+			[]string{}},
+		{"gap only within a title", []lintRow{lintIssue("001", "X-Men", 1, ""), lintIssue("002", "Wolverine", 1, ""), lintIssue("003", "X-Men", 5, "")}, 0,
+			[]string{}},
+		{"event split", []lintRow{inEvent(lintIssue("001", "Siege", 1, ""), "Siege"), lintIssue("002", "Thor", 1, ""), inEvent(lintIssue("003", "Avengers", 1, ""), "Siege")}, 0,
+			[]string{"[event] 001 - 003: Event 'Siege' comes back after 1 titles without it"}},
+		{"event in a row", []lintRow{inEvent(lintIssue("001", "Siege", 1, ""), "Siege"), inEvent(lintIssue("002", "Avengers", 1, ""), "Siege"), lintIssue("003", "Thor", 1, "")}, 0,
+			[]string{}},
+		{"date backwards", []lintRow{lintIssue("001", "Siege", 1, "2005-06-01"), lintIssue("002", "Thor", 1, "2004-01-01")}, 0,
+			[]string{"[date] 001 - 002: Thor vol. 1 #1 is dated 2004-01-01, 17 months before Siege vol. 1 #1 in 001 - 001"}},
+		{"date within months", []lintRow{lintIssue("001", "Siege", 1, "2005-06-01"), lintIssue("002", "Thor", 1, "2004-12-01")}, 0,
+			[]string{}},
+		{"date with months", []lintRow{lintIssue("001", "Siege", 1, "2005-06-01"), lintIssue("002", "Thor", 1, "2004-12-01")}, 3,
+			[]string{"[date] 001 - 002: Thor vol. 1 #1 is dated 2004-12-01, 6 months before Siege vol. 1 #1 in 001 - 001"}},
+		{"date unknown", []lintRow{lintIssue("001", "Siege", 1, "2005-06-01"), lintIssue("002", "Thor", 1, "")}, 0,
+			[]string{}},
+		{"character once", []lintRow{lintIssue("001", "X-Men", 1, ""), essential(lintIssue("001", "X-Men", 2, ""), "Wolverien")}, 0,
+			[]string{"[character] 001 - 001: Character 'Wolverien' only appears in X-Men vol. 1 #2"}},
+		{"character twice", []lintRow{essential(lintIssue("001", "X-Men", 1, ""), "Wolverine"), lintIssue("002", "Hulk", 1, ""), essential(lintIssue("003", "Avengers", 1, ""), "Wolverine")}, 0,
+			[]string{}},
+		{"protagonist alone", []lintRow{
+			essential(lintIssue("001", "Wolverine", 1, ""), "Wolverine", "Cyclops"),
+			essential(lintIssue("001", "Wolverine", 2, ""), "Wolverine", "Cyclops"),
+			essential(lintIssue("002", "X-Men", 1, ""), "Cyclops"),
+			essential(lintIssue("002", "X-Men", 2, ""), "Cyclops"),
+		}, 0, []string{"[protagonist] 001 - 001: Protagonist 'Wolverine' of essential 'Wolverine' is in no other essential title"}},
+		{"protagonist elsewhere", []lintRow{
+			essential(lintIssue("001", "Wolverine", 1, ""), "Wolverine", "Cyclops"),
+			essential(lintIssue("001", "Wolverine", 2, ""), "Wolverine", "Cyclops"),
+			essential(lintIssue("002", "X-Men", 1, ""), "Cyclops"),
+			essential(lintIssue("002", "X-Men", 2, ""), "Cyclops"),
+			essential(lintIssue("003", "Avengers", 1, ""), "Wolverine"),
+			essential(lintIssue("003", "Avengers", 2, ""), "Wolverine"),
+		}, 0, []string{}},
+		{"protagonist from column", []lintRow{
+			func() lintRow {
+				r := essential(lintIssue("001", "Wolverine", 1, ""), "Wolverine", "Cyclops")
+				r.Protagonist = &Namable{Name: "Cyclops"}
+				return r
+			}(),
+			essential(lintIssue("001", "Wolverine", 2, ""), "Wolverine", "Cyclops"),
+			essential(lintIssue("002", "X-Men", 1, ""), "Cyclops"),
+			essential(lintIssue("002", "X-Men", 2, ""), "Cyclops"),
+		}, 0, []string{}},
+	}
+	for _, e := range tests {
+		got := []string{}
+		for _, p := range lint(e.rows, LintOptions{Months: e.months}).Problems {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, e.want) {
+			t.Errorf("%s: expected %q, got %q", e.name, e.want, got)
+		}
+	}
+}
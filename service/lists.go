@@ -0,0 +1,286 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var listIDRegexp = regexp.MustCompile("^[a-z0-9][a-z0-9-]{0,63}$")
+var codeRegexp = regexp.MustCompile("^[0-9]{3}$")
+
+// Reading list made by users
+// Each item is either one comic or all issues from a comic in a phase
+type ReadingList struct {
+	ID    string            `json:"id"`
+	Name  string            `json:"name"`
+	Notes string            `json:"notes,omitempty"`
+	Items []ReadingListItem `json:"items"`
+}
+
+type ReadingListItem struct {
+	ComicID string `json:"comicid,omitempty"`
+	PhaseID string `json:"phaseid,omitempty"`
+	SortID  string `json:"sortid,omitempty"`
+	Notes   string `json:"notes,omitempty"`
+}
+
+type ReadingLists []ReadingList
+
+func (l *ReadingList) ToJson() ([]byte, error) {
+	return json.MarshalIndent(l, "", "	")
+}
+
+func (l *ReadingList) IsEmpty() bool {
+	return l.ID == ""
+}
+
+func (l *ReadingLists) ToJson() ([]byte, error) {
+	return json.MarshalIndent(l, "", "	")
+}
+
+func (l *ReadingLists) IsEmpty() bool {
+	return l == nil
+}
+
+func ValidateListID(id string) error {
+	if !listIDRegexp.MatchString(id) {
+		return fmt.Errorf("Invalid list id '%s': must be up to 64 lowercase letters, digits or '-'", id)
+	}
+	return nil
+}
+
+// Check list is well formed and all items exist
+func (l *ReadingList) Validate(comics *ComicList, groups ComicGroups) error {
+	if strings.TrimSpace(l.Name) == "" {
+		return fmt.Errorf("List name cannot be empty")
+	}
+	if l.ID != "" {
+		err := ValidateListID(l.ID)
+		if err != nil {
+			return err
+		}
+	}
+	for i, e := range l.Items {
+		if (e.ComicID == "") == (e.PhaseID == "" && e.SortID == "") {
+			return fmt.Errorf("Item %v must have either 'comicid' or 'phaseid' and 'sortid'", i+1)
+		}
+		if e.ComicID == "" && (!codeRegexp.MatchString(e.PhaseID) || !codeRegexp.MatchString(e.SortID)) {
+			return fmt.Errorf("Item %v: 'phaseid' and 'sortid' must be 3 digit codes", i+1)
+		}
+	}
+	_, missing := l.resolve(comics, groups)
+	if len(missing) > 0 {
+		return fmt.Errorf("Items not found: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// List as first issues, ready for the fissues cards
+// Missing items are left out
+func ResolveReadingList(l *ReadingList, comics *ComicList, groups ComicGroups) *Fissues {
+	list, _ := l.resolve(comics, groups)
+	return &Fissues{Namable: Namable{ID: l.ID, Name: l.Name}, List: list}
+}
+
+func (l *ReadingList) resolve(comics *ComicList, groups ComicGroups) (ComicList, []string) {
+	byID := make(map[string]Comic)
+	for _, c := range *comics {
+		byID[c.ID] = c
+	}
+	list := ComicList{}
+	missing := []string{}
+	for _, e := range l.Items {
+		var issues ComicList
+		if e.ComicID != "" {
+			if c, exists := byID[e.ComicID]; exists {
+				issues = ComicList{c}
+			}
+		} else {
+			issues = groups.Get(e.PhaseID, e.SortID)
+		}
+		if len(issues) == 0 {
+			missing = append(missing, e.name())
+			continue
+		}
+		first := issues[0]
+		first.ComicList = issues
+		first.Ranges = GetIssueRanges(issues)
+		first.Comments = nil
+		if e.Notes != "" {
+			first.Comments = []string{e.Notes}
+		}
+		list = append(list, first)
+	}
+	return list, missing
+}
+
+func (e *ReadingListItem) name() string {
+	if e.ComicID != "" {
+		return fmt.Sprintf("comic '%s'", e.ComicID)
+	}
+	return fmt.Sprintf("issues '%s' from phase '%s'", e.SortID, e.PhaseID)
+}
+
+// Lowercase, no accents, words joined by '-'
+func Slug(name string) string {
+	words := strings.FieldsFunc(fold(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	slug := strings.Join(words, "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	if slug == "" {
+		return "list"
+	}
+	return slug
+}
+
+// Stores
+type ReadingListStore interface {
+	// All lists, by name
+	List() (*ReadingLists, error)
+	// Empty list if there is none with this id
+	Get(id string) (*ReadingList, error)
+	// New list, with an id made from its name
+	Create(l *ReadingList) error
+	// Create or replace list with its id
+	Save(l *ReadingList) error
+	Delete(id string) error
+}
+
+// One JSON file per list
+type FileReadingListStore struct {
+	sync.Mutex
+	folder string
+}
+
+func NewFileReadingListStore(folder string) (*FileReadingListStore, error) {
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create lists folder '%s': %v", folder, err)
+	}
+	return &FileReadingListStore{folder: folder}, nil
+}
+
+func (s *FileReadingListStore) List() (*ReadingLists, error) {
+	s.Lock()
+	defer s.Unlock()
+	files, err := ioutil.ReadDir(s.folder)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read folder '%s': %v", s.folder, err)
+	}
+	lists := ReadingLists{}
+	for _, f := range files {
+		id := strings.TrimSuffix(f.Name(), ".json")
+		if f.IsDir() || id == f.Name() || ValidateListID(id) != nil {
+			continue
+		}
+		l, err := s.read(id)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, *l)
+	}
+	sort.SliceStable(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return &lists, nil
+}
+
+func (s *FileReadingListStore) Get(id string) (*ReadingList, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.read(id)
+}
+
+func (s *FileReadingListStore) Create(l *ReadingList) error {
+	s.Lock()
+	defer s.Unlock()
+	slug := Slug(l.Name)
+	id := slug
+	for n := 2; ; n++ {
+		_, err := os.Stat(s.file(id))
+		if os.IsNotExist(err) {
+			break
+		}
+		id = fmt.Sprintf("%s-%v", slug, n)
+	}
+	l.ID = id
+	return s.write(l)
+}
+
+func (s *FileReadingListStore) Save(l *ReadingList) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.write(l)
+}
+
+func (s *FileReadingListStore) Delete(id string) error {
+	err := ValidateListID(id)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	err = os.Remove(s.file(id))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Cannot delete file '%s': %v", s.file(id), err)
+	}
+	return nil
+}
+
+func (s *FileReadingListStore) read(id string) (*ReadingList, error) {
+	err := ValidateListID(id)
+	if err != nil {
+		return nil, err
+	}
+	file := s.file(id)
+	bytes, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &ReadingList{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read file '%s': %v", file, err)
+	}
+	l := &ReadingList{}
+	err = json.Unmarshal(bytes, l)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse file '%s': %v", file, err)
+	}
+	// File name wins
+	l.ID = id
+	return l, nil
+}
+
+// Write aside and rename, so a crash never leaves half a file
+func (s *FileReadingListStore) write(l *ReadingList) error {
+	err := ValidateListID(l.ID)
+	if err != nil {
+		return err
+	}
+	bytes, err := l.ToJson()
+	if err != nil {
+		return err
+	}
+	file := s.file(l.ID)
+	tmp := fmt.Sprintf("%s.tmp", file)
+	err = ioutil.WriteFile(tmp, bytes, 0644)
+	if err != nil {
+		return fmt.Errorf("Cannot write file '%s': %v", tmp, err)
+	}
+	err = os.Rename(tmp, file)
+	if err != nil {
+		return fmt.Errorf("Cannot write file '%s': %v", file, err)
+	}
+	return nil
+}
+
+func (s *FileReadingListStore) file(id string) string {
+	return filepath.Join(s.folder, fmt.Sprintf("%s.json", id))
+}
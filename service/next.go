@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+)
+
+// What to read next
+type NextQuery struct {
+	Essentials bool
+	Character  string
+	Event      string
+}
+
+func NewNextQuery(v url.Values) NextQuery {
+	return NextQuery{
+		Essentials: v.Get("essentials") == "true",
+		Character:  v.Get("character"),
+		Event:      v.Get("event"),
+	}
+}
+
+func (q *NextQuery) Match(c *Comic) bool {
+	if q.Essentials && !c.Essential {
+		return false
+	}
+	if q.Character != "" && !c.Characters.contains(q.Character) {
+		return false
+	}
+	if q.Event != "" && c.EventID != q.Event {
+		return false
+	}
+	return true
+}
+
+// Next comic, with progress over the comics matching the query
+type Next struct {
+	Reader string `json:"reader"`
+	Comic  *Comic `json:"comic,omitempty"`
+	Read   int    `json:"read"`
+	Total  int    `json:"total"`
+	Done   bool   `json:"done"`
+}
+
+func (n *Next) ToJson() ([]byte, error) {
+	return json.MarshalIndent(n, "", "	")
+}
+
+func (n *Next) IsEmpty() bool {
+	return n.Total == 0
+}
+
+// First unread comic in reading order: phase, then sortid, then issue order
+// Nil progress starts from the beginning
+func NextToRead(p *Progress, comics *ComicList, q NextQuery) *Next {
+	n := &Next{}
+	if p != nil {
+		n.Reader = p.Reader
+	}
+	l := ComicList{}
+	for i := range *comics {
+		if (*comics)[i].ID != "" && q.Match(&(*comics)[i]) {
+			l = append(l, (*comics)[i])
+		}
+	}
+	less, _ := comicSorter(l, "order")
+	sort.SliceStable(l, less)
+	for i := range l {
+		if p.IsRead(l[i].ID) {
+			n.Read++
+			continue
+		}
+		if n.Comic == nil {
+			n.Comic = &l[i]
+		}
+	}
+	n.Total = len(l)
+	n.Done = n.Comic == nil
+	return n
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const DefaultReader = "default"
+
+var readerRegexp = regexp.MustCompile("^[a-z0-9_-]{1,32}$")
+
+// Comics read by one reader, by Marvel comic ID
+type Progress struct {
+	Reader string            `json:"reader"`
+	Read   map[string]string `json:"read"` // Comic ID -> When it was marked
+}
+
+func NewProgress(reader string) *Progress {
+	return &Progress{Reader: reader, Read: make(map[string]string)}
+}
+
+func (p *Progress) ToJson() ([]byte, error) {
+	return json.MarshalIndent(p, "", "	")
+}
+
+func (p *Progress) IsEmpty() bool {
+	return p.Reader == ""
+}
+
+// Nil progress has nothing read
+func (p *Progress) IsRead(id string) bool {
+	if p == nil {
+		return false
+	}
+	_, exists := p.Read[id]
+	return exists
+}
+
+// Mark comics as read, or unread
+func (p *Progress) Mark(comics ComicList, read bool) {
+	at := time.Now().UTC().Format(time.RFC3339)
+	for _, c := range comics {
+		if c.ID == "" {
+			continue
+		}
+		if read {
+			if !p.IsRead(c.ID) {
+				p.Read[c.ID] = at
+			}
+		} else {
+			delete(p.Read, c.ID)
+		}
+	}
+}
+
+// How many of these comics have been read
+// Comics without Marvel ID cannot be tracked and don't count
+func (p *Progress) Count(comics ComicList) (int, int) {
+	read, total := 0, 0
+	for _, c := range comics {
+		if c.ID == "" {
+			continue
+		}
+		total++
+		if p.IsRead(c.ID) {
+			read++
+		}
+	}
+	return read, total
+}
+
+// Comics by phase and sortid
+type ComicGroups map[string]ComicList
+
+func GroupComics(comics *ComicList) ComicGroups {
+	g := make(ComicGroups)
+	for _, c := range *comics {
+		key := groupKey(c.PhaseID, c.SortID)
+		g[key] = append(g[key], c)
+	}
+	return g
+}
+
+func (g ComicGroups) Get(phaseID, sortID string) ComicList {
+	return g[groupKey(phaseID, sortID)]
+}
+
+func groupKey(phaseID, sortID string) string {
+	return fmt.Sprintf("%s/%s", phaseID, sortID)
+}
+
+func ValidateReader(reader string) error {
+	if !readerRegexp.MatchString(reader) {
+		return fmt.Errorf("Invalid reader '%s': must be 1 to 32 lowercase letters, digits, '-' or '_'", reader)
+	}
+	return nil
+}
+
+// Completion
+type Completion struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Read    int     `json:"read"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+type ProgressSummary struct {
+	Reader     string       `json:"reader"`
+	Read       int          `json:"read"`
+	Total      int          `json:"total"`
+	Percent    float64      `json:"percent"`
+	Phases     []Completion `json:"phases"`
+	Events     []Completion `json:"events"`
+	Characters []Completion `json:"characters"`
+}
+
+func (s *ProgressSummary) ToJson() ([]byte, error) {
+	return json.MarshalIndent(s, "", "	")
+}
+
+func (s *ProgressSummary) IsEmpty() bool {
+	return s.Reader == ""
+}
+
+// Completion per phase, event and character, in reading order
+func GetProgressSummary(p *Progress, comics *ComicList) *ProgressSummary {
+	s := &ProgressSummary{Reader: p.Reader}
+	phases := newCompletions()
+	events := newCompletions()
+	characters := newCompletions()
+	for _, c := range *comics {
+		if c.ID == "" {
+			continue
+		}
+		read := p.IsRead(c.ID)
+		s.Total++
+		if read {
+			s.Read++
+		}
+		phases.add(Namable{ID: c.PhaseID, Name: c.PhaseName}, read)
+		for _, e := range ComicEvent(&c) {
+			events.add(e, read)
+		}
+		for _, e := range c.Characters {
+			characters.add(e, read)
+		}
+	}
+	s.Percent = percent(s.Read, s.Total)
+	s.Phases = phases.list()
+	s.Events = events.list()
+	s.Characters = characters.list()
+	return s
+}
+
+type completions struct {
+	order []string
+	m     map[string]*Completion
+}
+
+func newCompletions() *completions {
+	return &completions{m: make(map[string]*Completion)}
+}
+
+func (c *completions) add(n Namable, read bool) {
+	e, exists := c.m[n.ID]
+	if !exists {
+		e = &Completion{ID: n.ID, Name: n.Name}
+		c.m[n.ID] = e
+		c.order = append(c.order, n.ID)
+	}
+	e.Total++
+	if read {
+		e.Read++
+	}
+}
+
+func (c *completions) list() []Completion {
+	l := []Completion{}
+	for _, id := range c.order {
+		e := c.m[id]
+		e.Percent = percent(e.Read, e.Total)
+		l = append(l, *e)
+	}
+	return l
+}
+
+// Rounded to 1 decimal
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*1000/float64(total)) / 10
+}
+
+// Stores
+type ProgressStore interface {
+	// Progress for reader, empty if there is none yet
+	Get(reader string) (*Progress, error)
+	// Change progress for reader, all or nothing
+	Update(reader string, update func(p *Progress)) (*Progress, error)
+}
+
+// One JSON file per reader
+type FileProgressStore struct {
+	sync.Mutex
+	folder string
+}
+
+func NewFileProgressStore(folder string) (*FileProgressStore, error) {
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create progress folder '%s': %v", folder, err)
+	}
+	return &FileProgressStore{folder: folder}, nil
+}
+
+func (s *FileProgressStore) Get(reader string) (*Progress, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.read(reader)
+}
+
+func (s *FileProgressStore) Update(reader string, update func(p *Progress)) (*Progress, error) {
+	s.Lock()
+	defer s.Unlock()
+	p, err := s.read(reader)
+	if err != nil {
+		return nil, err
+	}
+	update(p)
+	bytes, err := p.ToJson()
+	if err != nil {
+		return nil, err
+	}
+	// Write aside and rename, so a crash never leaves half a file
+	file := s.file(reader)
+	tmp := fmt.Sprintf("%s.tmp", file)
+	err = ioutil.WriteFile(tmp, bytes, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot write file '%s': %v", tmp, err)
+	}
+	err = os.Rename(tmp, file)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot write file '%s': %v", file, err)
+	}
+	return p, nil
+}
+
+func (s *FileProgressStore) read(reader string) (*Progress, error) {
+	err := ValidateReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	file := s.file(reader)
+	bytes, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return NewProgress(reader), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read file '%s': %v", file, err)
+	}
+	p := NewProgress(reader)
+	err = json.Unmarshal(bytes, p)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse file '%s': %v", file, err)
+	}
+	if p.Read == nil {
+		p.Read = make(map[string]string)
+	}
+	return p, nil
+}
+
+func (s *FileProgressStore) file(reader string) string {
+	return filepath.Join(s.folder, fmt.Sprintf("%s.json", reader))
+}
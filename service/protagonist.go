@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Protagonist of a title, from its issues: the one named in the protagonist
+// column if any, then a character named in the title, then the character
+// in most of its issues, first listed when even
+// False when no issue has characters
+func GetProtagonist(title string, issues ComicList, name string) (Namable, bool) {
+	order := NamableList{}
+	count := make(map[string]int)
+	for _, c := range issues {
+		for _, ch := range c.Characters {
+			if ch.Name == "" {
+				continue
+			}
+			k := protagonistKey(ch)
+			if count[k] == 0 {
+				order = append(order, ch)
+			}
+			count[k]++
+		}
+	}
+	if len(order) == 0 {
+		return Namable{}, false
+	}
+
+	if name != "" {
+		for _, ch := range order {
+			if fold(ch.Name) == fold(name) {
+				return ch, true
+			}
+		}
+	}
+
+	// Longest name wins: 'Spider-Woman' over 'Spider-Man' in 'Spider-Woman: Origin'
+	words := fmt.Sprintf(" %s ", nameWords(title))
+	best, found := Namable{}, false
+	for _, ch := range order {
+		base := nameWords(strings.Split(ch.Name, " (")[0])
+		if len(base) < 3 || !strings.Contains(words, fmt.Sprintf(" %s ", base)) {
+			continue
+		}
+		if !found || len(base) > len(nameWords(strings.Split(best.Name, " (")[0])) {
+			best, found = ch, true
+		}
+	}
+	if found {
+		return best, true
+	}
+
+	best = order[0]
+	for _, ch := range order[1:] {
+		if count[protagonistKey(ch)] > count[protagonistKey(best)] {
+			best = ch
+		}
+	}
+	return best, true
+}
+
+// Characters read from the XLSX only have names
+func protagonistKey(ch Namable) string {
+	if ch.ID != "" {
+		return ch.ID
+	}
+	return ch.Name
+}
+
+// Lowercase words, without accents nor punctuation: 'Spider-Man' is 'spider man'
+func nameWords(s string) string {
+	return strings.Join(strings.FieldsFunc(fold(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), " ")
+}
+
+// Set the protagonist of every comic, by title
+// Names from the protagonist column, by title, must be one of its characters
+func setProtagonists(comics ComicList, names map[string]string, protagonists map[string]Namable) error {
+	groups := GroupComics(&comics)
+	for i, c := range comics {
+		key := groupKey(c.PhaseID, c.SortID)
+		p, exists := protagonists[key]
+		if !exists {
+			name := names[key]
+			p, exists = GetProtagonist(c.Title, groups[key], name)
+			if name != "" && (!exists || fold(p.Name) != fold(name)) {
+				return fmt.Errorf("Protagonist '%s' of '%s' is not one of its characters", name, c.Title)
+			}
+			if !exists {
+				continue
+			}
+			protagonists[key] = p
+		}
+		comics[i].Protagonist = &p
+	}
+	return nil
+}
+
+// First issues list the protagonist as their only character, and carry it
+func setFissuesProtagonists(l ComicList, protagonists map[string]Namable) {
+	for i, c := range l {
+		if p, exists := protagonists[groupKey(c.PhaseID, c.SortID)]; exists {
+			l[i].Characters = NamableList{p}
+			l[i].Protagonist = &p
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+)
+
+func characters(names ...string) Comic {
+	c := Comic{}
+	for _, n := range names {
+		c.Characters = append(c.Characters, Namable{ID: n, Name: n})
+	}
+	return c
+}
+
+func TestGetProtagonist(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		issues ComicList
+		column string
+		want   string
+	}{
+		{"no issues", "Siege", ComicList{}, "", ""},
+		{"no characters", "Siege", ComicList{characters(), characters("")}, "", ""},
+		{"most appearances", "Siege", ComicList{characters("Ares", "Thor"), characters("Thor")}, "", "Thor"},
+		{"first when even", "Siege", ComicList{characters("Ares", "Thor")}, "", "Ares"},
+		{"in title", "Amazing Spider-Man: Brand New Day", ComicList{characters("Aunt May", "Spider-Man"), characters("Aunt May")}, "", "Spider-Man"},
+		{"in title with real name", "Spider-Man: One More Day", ComicList{characters("Mephisto", "Spider-Man (Peter Parker)")}, "", "Spider-Man (Peter Parker)"},
+		{"longest in title", "Spider-Woman: Origin", ComicList{characters("Spider-Man", "Spider-Woman")}, "", "Spider-Woman"},
+		{"whole words only", "Thorough Investigation", ComicList{characters("Thor", "Ares"), characters("Ares")}, "", "Ares"},
+		{"column", "Siege", ComicList{characters("Ares", "Thor"), characters("Thor")}, "ares", "Ares"},
+		{"column not a character", "Siege", ComicList{characters("Ares", "Thor"), characters("Thor")}, "Loki", "Thor"},
+	}
+	for _, e := range tests {
+		got, found := GetProtagonist(e.title, e.issues, e.column)
+		if found != (e.want != "") || got.Name != e.want {
+			t.Errorf("%s: expected '%s', got '%s' (%v)", e.name, e.want, got.Name, found)
+		}
+	}
+}
+
+func TestSetProtagonists(t *testing.T) {
+	comics := ComicList{
+		{PhaseID: "001", SortID: "001", Title: "Siege", Characters: NamableList{{ID: "001", Name: "Ares"}}},
+		{PhaseID: "001", SortID: "001", Title: "Siege", Characters: NamableList{{ID: "002", Name: "Thor"}}},
+		{PhaseID: "001", SortID: "002", Title: "Empty"},
+	}
+	err := setProtagonists(comics, map[string]string{"001/001": "Thor"}, map[string]Namable{})
+	if err != nil {
+		t.Fatalf("Cannot set protagonists: %v", err)
+	}
+	for i, want := range []string{"Thor", "Thor", ""} {
+		got := ""
+		if comics[i].Protagonist != nil {
+			got = comics[i].Protagonist.Name
+		}
+		if got != want {
+			t.Errorf("Comic %v: expected '%s', got '%s'", i, want, got)
+		}
+	}
+
+	err = setProtagonists(comics, map[string]string{"001/001": "Loki"}, map[string]Namable{})
+	if err == nil {
+		t.Errorf("Expected error for a protagonist not in the title")
+	}
+}
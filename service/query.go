@@ -0,0 +1,297 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pagination defaults
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// List query from URL parameters
+type ListQuery struct {
+	Limit     int
+	Offset    int
+	Sort      string
+	Desc      bool
+	Phase     string
+	Event     string
+	Character string
+	Creator   string
+	Universe  string
+	Essential *bool
+	YearFrom  int
+	YearTo    int
+}
+
+func NewListQuery(v url.Values) (ListQuery, error) {
+	q := ListQuery{Limit: DefaultLimit}
+	var err error
+	if s := v.Get("limit"); s != "" {
+		q.Limit, err = strconv.Atoi(s)
+		if err != nil || q.Limit <= 0 || q.Limit > MaxLimit {
+			return q, fmt.Errorf("Invalid limit '%s': must be between 1 and %v", s, MaxLimit)
+		}
+	}
+	if s := v.Get("offset"); s != "" {
+		q.Offset, err = strconv.Atoi(s)
+		if err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("Invalid offset '%s'", s)
+		}
+	}
+	q.Sort = v.Get("sort")
+	if strings.HasPrefix(q.Sort, "-") {
+		q.Sort = q.Sort[1:]
+		q.Desc = true
+	}
+	q.Phase = v.Get("phase")
+	q.Event = v.Get("event")
+	q.Character = v.Get("character")
+	q.Creator = v.Get("creator")
+	q.Universe = v.Get("universe")
+	if s := v.Get("essential"); s != "" {
+		essential, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("Invalid essential '%s': must be true or false", s)
+		}
+		q.Essential = &essential
+	}
+	if s := v.Get("year_from"); s != "" {
+		q.YearFrom, err = strconv.Atoi(s)
+		if err != nil {
+			return q, fmt.Errorf("Invalid year_from '%s'", s)
+		}
+	}
+	if s := v.Get("year_to"); s != "" {
+		q.YearTo, err = strconv.Atoi(s)
+		if err != nil {
+			return q, fmt.Errorf("Invalid year_to '%s'", s)
+		}
+	}
+	return q, nil
+}
+
+// True if any comic field filter is set
+func (q *ListQuery) IsFiltered() bool {
+	return q.Phase != "" || q.Event != "" || q.Character != "" || q.Creator != "" ||
+		q.Universe != "" || q.Essential != nil || q.YearFrom != 0 || q.YearTo != 0
+}
+
+func (q *ListQuery) Match(c *Comic) bool {
+	if q.Phase != "" && c.PhaseID != q.Phase {
+		return false
+	}
+	if q.Event != "" && c.EventID != q.Event {
+		return false
+	}
+	if q.Character != "" && !c.Characters.contains(q.Character) {
+		return false
+	}
+	if q.Creator != "" && !c.Creators.contains(q.Creator) {
+		return false
+	}
+	if q.Universe != "" && !strings.EqualFold(c.Universe, q.Universe) {
+		return false
+	}
+	if q.Essential != nil && c.Essential != *q.Essential {
+		return false
+	}
+	if q.YearFrom != 0 || q.YearTo != 0 {
+		year := c.Year()
+		if year == 0 || (q.YearFrom != 0 && year < q.YearFrom) || (q.YearTo != 0 && year > q.YearTo) {
+			return false
+		}
+	}
+	return true
+}
+
+// Page of results
+type Page struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Next   string      `json:"next,omitempty"`
+	Items  interface{} `json:"items"`
+}
+
+func (p *Page) ToJson() ([]byte, error) {
+	return json.MarshalIndent(p, "", "	")
+}
+
+func (p *Page) IsEmpty() bool {
+	return false
+}
+
+func (p *Page) HasNext() bool {
+	return p.Offset+p.Limit < p.Total
+}
+
+// Filter, sort and paginate comics
+// Only an invalid sort fails
+func QueryComics(comics *ComicList, q ListQuery) (*Page, error) {
+	result := ComicList{}
+	for i := range *comics {
+		if q.Match(&(*comics)[i]) {
+			result = append(result, (*comics)[i])
+		}
+	}
+	less, err := comicSorter(result, q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if q.Desc {
+			return less(j, i)
+		}
+		return less(i, j)
+	})
+	p := &Page{Total: len(result), Offset: q.Offset, Limit: q.Limit}
+	start, end := bounds(len(result), q)
+	p.Items = result[start:end]
+	return p, nil
+}
+
+// Filter, sort and paginate namables
+// When comic filters are set, only namables related to matching comics are kept
+// Only an invalid sort fails
+func QueryNamables(namables *NamableList, comics *ComicList, related func(c *Comic) NamableList, q ListQuery) (*Page, error) {
+	result := NamableList{}
+	if q.IsFiltered() {
+		ids := map[string]bool{}
+		for i := range *comics {
+			c := &(*comics)[i]
+			if q.Match(c) {
+				for _, n := range related(c) {
+					ids[n.ID] = true
+				}
+			}
+		}
+		for _, n := range *namables {
+			if ids[n.ID] {
+				result = append(result, n)
+			}
+		}
+	} else {
+		result = append(result, *namables...)
+	}
+	switch q.Sort {
+	case "", "id":
+		sort.SliceStable(result, func(i, j int) bool { return lessID(result[i].ID, result[j].ID) })
+	case "name":
+		sort.Stable(ByName(result))
+	default:
+		return nil, fmt.Errorf("Invalid sort '%s': must be one of [id, name]", q.Sort)
+	}
+	if q.Desc {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	p := &Page{Total: len(result), Offset: q.Offset, Limit: q.Limit}
+	start, end := bounds(len(result), q)
+	p.Items = result[start:end]
+	return p, nil
+}
+
+// Related namables
+func ComicCharacters(c *Comic) NamableList {
+	return c.Characters
+}
+
+func ComicCreators(c *Comic) NamableList {
+	return c.Creators
+}
+
+func ComicEvent(c *Comic) NamableList {
+	if c.EventID == "" {
+		return NamableList{}
+	}
+	return NamableList{Namable{ID: c.EventID, Name: c.Event}}
+}
+
+// Publication year from date, 0 if unknown
+func (c *Comic) Year() int {
+	if len(c.Date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(c.Date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+func (n NamableList) contains(id string) bool {
+	return n.index(id) >= 0
+}
+
+func (n NamableList) index(id string) int {
+	for i, e := range n {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Default order is reading order: phase, then sortid
+func comicSorter(l ComicList, field string) (func(i, j int) bool, error) {
+	switch field {
+	case "", "order":
+		return func(i, j int) bool {
+			if l[i].PhaseID != l[j].PhaseID {
+				return l[i].PhaseID < l[j].PhaseID
+			}
+			return l[i].SortID < l[j].SortID
+		}, nil
+	case "id":
+		return func(i, j int) bool { return lessID(l[i].ID, l[j].ID) }, nil
+	case "date":
+		return func(i, j int) bool { return l[i].Date < l[j].Date }, nil
+	case "title":
+		return func(i, j int) bool { return l[i].Title < l[j].Title }, nil
+	case "collection":
+		return func(i, j int) bool {
+			if l[i].Collection != l[j].Collection {
+				return l[i].Collection < l[j].Collection
+			}
+			if l[i].Vol != l[j].Vol {
+				return l[i].Vol < l[j].Vol
+			}
+			return l[i].Num < l[j].Num
+		}, nil
+	}
+	return nil, fmt.Errorf("Invalid sort '%s': must be one of [order, id, date, title, collection]", field)
+}
+
+// Numeric ids by number, '9298' before '10223', others as text after them
+func lessID(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return x < y
+	case errA == nil || errB == nil:
+		return errA == nil
+	}
+	return a < b
+}
+
+func bounds(n int, q ListQuery) (int, int) {
+	start := q.Offset
+	if start > n {
+		start = n
+	}
+	end := start + q.Limit
+	if end > n {
+		end = n
+	}
+	return start, end
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func queryComics() *ComicList {
+	return &ComicList{
+		{ID: "10", Title: "B", PhaseID: "001", SortID: "001", Date: "2009-05-01", Essential: true, Characters: NamableList{{ID: "002", Name: "Loki"}}},
+		{ID: "9", Title: "A", PhaseID: "001", SortID: "002", Date: "2010-01-01"},
+		{ID: "100", Title: "C", PhaseID: "002", SortID: "001", Date: "2011-03-01", Essential: true, Characters: NamableList{{ID: "001", Name: "Thor"}}},
+		{ID: "11", Title: "D", PhaseID: "002", SortID: "002"},
+	}
+}
+
+func listQuery(t *testing.T, s string) ListQuery {
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		t.Fatalf("Invalid query '%s': %v", s, err)
+	}
+	q, err := NewListQuery(v)
+	if err != nil {
+		t.Fatalf("Invalid query '%s': %v", s, err)
+	}
+	return q
+}
+
+func TestNewListQuery(t *testing.T) {
+	q := listQuery(t, "")
+	if q.Limit != DefaultLimit || q.Offset != 0 || q.Sort != "" || q.Essential != nil || q.IsFiltered() {
+		t.Errorf("Expected defaults, got %+v", q)
+	}
+	q = listQuery(t, "sort=-date&limit=20&offset=40&essential=false&year_from=2000")
+	if q.Sort != "date" || !q.Desc || q.Limit != 20 || q.Offset != 40 || q.Essential == nil || *q.Essential || q.YearFrom != 2000 || !q.IsFiltered() {
+		t.Errorf("Unexpected %+v", q)
+	}
+	for _, s := range []string{"limit=0", "limit=1001", "limit=x", "offset=-1", "essential=maybe", "year_from=x", "year_to=2o10"} {
+		v, _ := url.ParseQuery(s)
+		if _, err := NewListQuery(v); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestQueryComics(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+		total int
+		next  bool
+	}{
+		{"", []string{"10", "9", "100", "11"}, 4, false},
+		{"phase=002", []string{"100", "11"}, 2, false},
+		{"essential=true", []string{"10", "100"}, 2, false},
+		{"essential=false", []string{"9", "11"}, 2, false},
+		{"character=001", []string{"100"}, 1, false},
+		{"year_from=2010", []string{"9", "100"}, 2, false},
+		{"year_to=2010", []string{"10", "9"}, 2, false},
+		{"year_from=2010&year_to=2010", []string{"9"}, 1, false},
+		{"sort=id", []string{"9", "10", "11", "100"}, 4, false},
+		{"sort=-id", []string{"100", "11", "10", "9"}, 4, false},
+		{"sort=date", []string{"11", "10", "9", "100"}, 4, false},
+		{"sort=title", []string{"9", "10", "100", "11"}, 4, false},
+		{"limit=2", []string{"10", "9"}, 4, true},
+		{"limit=2&offset=2", []string{"100", "11"}, 4, false},
+		{"limit=1&offset=2", []string{"100"}, 4, true},
+		{"offset=10", []string{}, 4, false},
+		{"phase=003", []string{}, 0, false},
+	}
+	for _, e := range tests {
+		p, err := QueryComics(queryComics(), listQuery(t, e.query))
+		if err != nil {
+			t.Errorf("%s: %v", e.query, err)
+			continue
+		}
+		got := []string{}
+		for _, c := range p.Items.(ComicList) {
+			got = append(got, c.ID)
+		}
+		if !reflect.DeepEqual(got, e.want) || p.Total != e.total || p.HasNext() != e.next {
+			t.Errorf("%s: expected %q of %v (next %v), got %q of %v (next %v)", e.query, e.want, e.total, e.next, got, p.Total, p.HasNext())
+		}
+	}
+	if _, err := QueryComics(queryComics(), listQuery(t, "sort=bogus")); err == nil {
+		t.Error("sort=bogus: expected an error")
+	}
+}
+
+func TestQueryNamables(t *testing.T) {
+	characters := &NamableList{{ID: "001", Name: "Thor"}, {ID: "002", Name: "Loki"}, {ID: "010", Name: "Ares"}}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"001", "002", "010"}},
+		{"sort=-id", []string{"010", "002", "001"}},
+		{"sort=name", []string{"010", "002", "001"}},
+		{"sort=-name", []string{"001", "002", "010"}},
+		{"phase=002", []string{"001"}},
+		{"essential=true", []string{"001", "002"}},
+		{"essential=false", []string{}},
+		{"limit=1&offset=1", []string{"002"}},
+	}
+	for _, e := range tests {
+		p, err := QueryNamables(characters, queryComics(), ComicCharacters, listQuery(t, e.query))
+		if err != nil {
+			t.Errorf("%s: %v", e.query, err)
+			continue
+		}
+		got := []string{}
+		for _, n := range p.Items.(NamableList) {
+			got = append(got, n.ID)
+		}
+		if !reflect.DeepEqual(got, e.want) {
+			t.Errorf("%s: expected %q, got %q", e.query, e.want, got)
+		}
+	}
+	if _, err := QueryNamables(characters, queryComics(), ComicCharacters, listQuery(t, "sort=date")); err == nil {
+		t.Error("sort=date: expected an error")
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Consecutive issues from one collection and volume: 'X-Men vol. 2 #1 - #5'
+// Only whole numbers make a range: #0.1 or #1.5 always stand alone
+type IssueRange struct {
+	Collection string  `json:"collection"`
+	Vol        int     `json:"vol"`
+	From       float64 `json:"from"`
+	To         float64 `json:"to"`
+}
+
+type IssueRangeList []IssueRange
+
+func (r IssueRange) String() string {
+	name := fmt.Sprintf("%s vol. %v #%v", r.Collection, r.Vol, r.From)
+	if r.To != r.From {
+		name = fmt.Sprintf("%s - #%v", name, r.To)
+	}
+	return name
+}
+
+func (l *IssueRangeList) ToJson() ([]byte, error) {
+	return json.MarshalIndent(l, "", "	")
+}
+
+func (l *IssueRangeList) IsEmpty() bool {
+	return len(*l) <= 0
+}
+
+func (l IssueRangeList) Strings() []string {
+	s := make([]string, len(l))
+	for i, e := range l {
+		s[i] = e.String()
+	}
+	return s
+}
+
+// Group comics by collection and volume, in order of first appearance
+// Numbers are sorted and deduplicated within each group, so annuals
+// (their own collection) and issues out of order are handled too
+func GetIssueRanges(comics ComicList) IssueRangeList {
+	type volume struct {
+		collection string
+		vol        int
+	}
+	order := []volume{}
+	nums := map[volume][]float64{}
+	for _, c := range comics {
+		k := volume{c.Collection, c.Vol}
+		if _, exists := nums[k]; !exists {
+			order = append(order, k)
+		}
+		nums[k] = append(nums[k], c.Num)
+	}
+
+	l := IssueRangeList{}
+	for _, k := range order {
+		v := nums[k]
+		sort.Float64s(v)
+		var current *IssueRange
+		for i, n := range v {
+			if i > 0 && n == v[i-1] {
+				continue
+			}
+			if current != nil && isWhole(n) && isWhole(current.To) && n == current.To+1 {
+				current.To = n
+				continue
+			}
+			l = append(l, IssueRange{Collection: k.collection, Vol: k.vol, From: n, To: n})
+			current = &l[len(l)-1]
+			if !isWhole(n) {
+				// Nothing follows a fractional issue
+				current = nil
+			}
+		}
+	}
+	return l
+}
+
+func isWhole(n float64) bool {
+	return n == math.Trunc(n)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func issues(collection string, vol int, nums ...float64) ComicList {
+	l := ComicList{}
+	for _, n := range nums {
+		l = append(l, Comic{Collection: collection, Vol: vol, Num: n})
+	}
+	return l
+}
+
+func TestGetIssueRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		comics ComicList
+		want   []string
+	}{
+		{"empty", ComicList{}, []string{}},
+		{"single", issues("X-Men", 2, 1), []string{"X-Men vol. 2 #1"}},
+		{"consecutive", issues("X-Men", 2, 1, 2, 3, 4, 5), []string{"X-Men vol. 2 #1 - #5"}},
+		{"gap", issues("X-Men", 2, 1, 2, 3, 7, 8), []string{"X-Men vol. 2 #1 - #3", "X-Men vol. 2 #7 - #8"}},
+		{"single after gap", issues("X-Men", 2, 1, 2, 5), []string{"X-Men vol. 2 #1 - #2", "X-Men vol. 2 #5"}},
+		{"single before gap", issues("Deadpool", 1, -1, 1, 2, 3), []string{"Deadpool vol. 1 #-1", "Deadpool vol. 1 #1 - #3"}},
+		{"out of order", issues("X-Men", 2, 3, 1, 2, 5, 4), []string{"X-Men vol. 2 #1 - #5"}},
+		{"duplicates", issues("X-Men", 2, 1, 1, 2, 2), []string{"X-Men vol. 2 #1 - #2"}},
+		{"point one", issues("Avengers", 4, 0.1, 1, 2), []string{"Avengers vol. 4 #0.1", "Avengers vol. 4 #1 - #2"}},
+		{"half issue", issues("Avengers", 4, 1, 1.5, 2, 3), []string{"Avengers vol. 4 #1", "Avengers vol. 4 #1.5", "Avengers vol. 4 #2 - #3"}},
+		{"fractional only", issues("Avengers", 4, 2.1, 1.1), []string{"Avengers vol. 4 #1.1", "Avengers vol. 4 #2.1"}},
+		{"annuals", append(issues("Deadpool", 1, 1, 2), append(issues("Deadpool Annual", 1, 1997), issues("Deadpool", 1, 3)...)...),
+			[]string{"Deadpool vol. 1 #1 - #3", "Deadpool Annual vol. 1 #1997"}},
+		{"annual years", issues("X-Men Annual", 1, 1998, 1997, 2000), []string{"X-Men Annual vol. 1 #1997 - #1998", "X-Men Annual vol. 1 #2000"}},
+		{"volumes", append(issues("X-Men", 2, 1, 2), issues("X-Men", 1, 1, 2)...), []string{"X-Men vol. 2 #1 - #2", "X-Men vol. 1 #1 - #2"}},
+	}
+	for _, e := range tests {
+		got := GetIssueRanges(e.comics).Strings()
+		if !reflect.DeepEqual(got, e.want) {
+			t.Errorf("%s: expected %q, got %q", e.name, e.want, got)
+		}
+	}
+}
+
+func TestIssueRangeModel(t *testing.T) {
+	got := GetIssueRanges(issues("X-Men", 2, 1, 2, 3, 5.5))
+	want := IssueRangeList{
+		{Collection: "X-Men", Vol: 2, From: 1, To: 3},
+		{Collection: "X-Men", Vol: 2, From: 5.5, To: 5.5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// Fissues read from JSON carry their ranges for API clients
+func TestNewComicRanges(t *testing.T) {
+	c, err := NewComic(map[string]interface{}{
+		"title": "Inhumans",
+		"comiclist": []interface{}{
+			map[string]interface{}{"collection": "Inhumans", "vol": float64(2), "num": float64(2)},
+			map[string]interface{}{"collection": "Inhumans", "vol": float64(2), "num": float64(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Cannot read comic: %v", err)
+	}
+	want := IssueRangeList{{Collection: "Inhumans", Vol: 2, From: 1, To: 2}}
+	if !reflect.DeepEqual(c.Ranges, want) {
+		t.Errorf("Expected %v, got %v", want, c.Ranges)
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tealeg/xlsx"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Comic files in the library
+var libraryExtensions = []string{".cbz", ".cbr", ".pdf"}
+
+// 'Amazing Spider-Man v2 #030', 'Amazing Spider-Man Vol. 2 030', 'X-Men_Annual_v1_1997'
+var fileVolRegexp = regexp.MustCompile(`(?i)^(.+?)[\s_]+v(?:ol(?:ume)?)?[\s_.]*(\d+)[\s_]+#?(-?\d+(?:\.\d+)?)$`)
+
+// 'Amazing Spider-Man #030', 'Amazing Spider-Man 030'
+var fileNumRegexp = regexp.MustCompile(`^(.+?)[\s_]+#?(-?\d+(?:\.\d+)?)$`)
+
+// Tags as '(1999)', '(Digital)' or '[Group]'
+var fileTagsRegexp = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+
+// Issue in the workbook, and where its files belong
+type LibraryIssue struct {
+	PhaseID    string  `json:"phaseid"`
+	PhaseName  string  `json:"phasename"`
+	SortID     string  `json:"sortid"`
+	Title      string  `json:"title"`
+	Collection string  `json:"collection"`
+	Vol        int     `json:"vol"`
+	Num        float64 `json:"num"`
+}
+
+// Comic file found in the library
+// Vol is 0 when the file does not tell
+type LibraryFile struct {
+	Path       string  `json:"path"`
+	Collection string  `json:"collection,omitempty"`
+	Vol        int     `json:"vol,omitempty"`
+	Num        float64 `json:"num,omitempty"`
+	Source     string  `json:"source,omitempty"`
+}
+
+type ScanMatch struct {
+	File   LibraryFile  `json:"file"`
+	Issue  LibraryIssue `json:"issue"`
+	Target string       `json:"target,omitempty"`
+	Moved  bool         `json:"moved,omitempty"`
+}
+
+// Owned issues with their files, issues with no file and files with no issue
+type ScanReport struct {
+	Owned     []ScanMatch    `json:"owned"`
+	Missing   []LibraryIssue `json:"missing"`
+	Unmatched []LibraryFile  `json:"unmatched"`
+}
+
+func (i LibraryIssue) String() string {
+	return IssueRange{Collection: i.Collection, Vol: i.Vol, From: i.Num, To: i.Num}.String()
+}
+
+func (r *ScanReport) ToJson() ([]byte, error) {
+	return json.MarshalIndent(r, "", "	")
+}
+
+func (r *ScanReport) IsEmpty() bool {
+	return len(r.Owned) == 0 && len(r.Missing) == 0 && len(r.Unmatched) == 0
+}
+
+// Match comic files in the library to rows of the XLSX
+// Matched files are moved to their 'NNN - Phase/NNN' folder if asked
+func ScanLibrary(f, path string, move bool) (*ScanReport, error) {
+	// Open file
+	xls, err := xlsx.OpenFile(f)
+	if err != nil {
+		return nil, err
+	}
+	issues, err := readLibraryIssues(xls)
+	if err != nil {
+		return nil, err
+	}
+	files, err := findLibraryFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ScanReport{Owned: []ScanMatch{}, Missing: []LibraryIssue{}, Unmatched: []LibraryFile{}}
+	index := newIssueIndex(issues)
+	owned := make(map[int]bool)
+	for _, file := range files {
+		i, found := index.find(file)
+		if !found {
+			report.Unmatched = append(report.Unmatched, file)
+			continue
+		}
+		owned[i] = true
+		report.Owned = append(report.Owned, ScanMatch{File: file, Issue: issues[i]})
+	}
+	for i, issue := range issues {
+		if !owned[i] {
+			report.Missing = append(report.Missing, issue)
+		}
+	}
+
+	if move {
+		for i := range report.Owned {
+			err = moveToLibraryFolder(path, &report.Owned[i])
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// Same rows, phases and sortids as the JSON generator
+func readLibraryIssues(xls *xlsx.File) ([]LibraryIssue, error) {
+	issues := []LibraryIssue{}
+	for sheet_i, sheet := range xls.Sheets {
+		phaseID, err := getCode(sheet_i + 1)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := readSheet(sheet)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			sID, err := getCode(r.SortID)
+			if err != nil {
+				return nil, err
+			}
+			issues = append(issues, LibraryIssue{
+				PhaseID:    phaseID,
+				PhaseName:  sheet.Name,
+				SortID:     sID,
+				Title:      r.Title,
+				Collection: r.Collection,
+				Vol:        r.Vol,
+				Num:        r.Num,
+			})
+		}
+	}
+	return issues, nil
+}
+
+// All comic files under path, by path
+func findLibraryFiles(path string) ([]LibraryFile, error) {
+	files := []LibraryFile{}
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isLibraryFile(p) {
+			return nil
+		}
+		files = append(files, ParseLibraryFile(p))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read library '%s': %v", path, err)
+	}
+	return files, nil
+}
+
+func isLibraryFile(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	for _, e := range libraryExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Collection, vol and number of a comic file
+// ComicInfo.xml inside CBZ files wins over the file name
+func ParseLibraryFile(p string) LibraryFile {
+	file := parseFileName(p)
+	if strings.ToLower(filepath.Ext(p)) == ".cbz" {
+		info, err := readComicInfo(p)
+		if err == nil && info.Series != "" && info.Number != "" {
+			num, err := strconv.ParseFloat(strings.TrimPrefix(info.Number, "#"), 64)
+			if err == nil {
+				file.Collection = info.Series
+				file.Num = num
+				file.Vol = 0
+				// Volume is often the start year instead
+				if info.Volume > 0 && info.Volume < 1000 {
+					file.Vol = info.Volume
+				}
+				file.Source = "comicinfo"
+			}
+		}
+	}
+	return file
+}
+
+func parseFileName(p string) LibraryFile {
+	file := LibraryFile{Path: p}
+	name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	name = strings.TrimSpace(fileTagsRegexp.ReplaceAllString(name, " "))
+	if m := fileVolRegexp.FindStringSubmatch(name); m != nil {
+		file.Collection = m[1]
+		file.Vol, _ = strconv.Atoi(m[2])
+		file.Num, _ = strconv.ParseFloat(m[3], 64)
+		file.Source = "filename"
+	} else if m := fileNumRegexp.FindStringSubmatch(name); m != nil {
+		file.Collection = m[1]
+		file.Num, _ = strconv.ParseFloat(m[2], 64)
+		file.Source = "filename"
+	}
+	file.Collection = strings.TrimSpace(strings.Replace(file.Collection, "_", " ", -1))
+	return file
+}
+
+// Issues by collection, vol and number
+// Collections are compared lowercase, without accents nor punctuation
+type issueIndex struct {
+	issues []LibraryIssue
+	byVol  map[string]int
+	byNum  map[string][]int
+}
+
+func newIssueIndex(issues []LibraryIssue) *issueIndex {
+	index := &issueIndex{issues: issues, byVol: make(map[string]int), byNum: make(map[string][]int)}
+	for i, e := range issues {
+		k := issueKey(e.Collection, e.Vol, e.Num)
+		if _, exists := index.byVol[k]; !exists {
+			index.byVol[k] = i
+		}
+		k = issueKey(e.Collection, 0, e.Num)
+		index.byNum[k] = append(index.byNum[k], i)
+	}
+	return index
+}
+
+// Files with no vol, or a wrong one, match if only one vol has that issue
+func (index *issueIndex) find(f LibraryFile) (int, bool) {
+	if f.Collection == "" {
+		return 0, false
+	}
+	if i, exists := index.byVol[issueKey(f.Collection, f.Vol, f.Num)]; exists && f.Vol > 0 {
+		return i, true
+	}
+	found := index.byNum[issueKey(f.Collection, 0, f.Num)]
+	if len(found) == 0 {
+		return 0, false
+	}
+	for _, i := range found[1:] {
+		if index.issues[i].Vol != index.issues[found[0]].Vol {
+			return 0, false
+		}
+	}
+	return found[0], true
+}
+
+func issueKey(collection string, vol int, num float64) string {
+	return fmt.Sprintf("%s|%v|%v", nameWords(collection), vol, num)
+}
+
+// Move file into 'NNN - Phase/NNN', the folders made by CreateFolders
+// Sortid folders are found by prefix, so they can be renamed after the code
+func moveToLibraryFolder(path string, m *ScanMatch) error {
+	phaseFolder := filepath.Join(path, fmt.Sprintf("%v - %s", m.Issue.PhaseID, m.Issue.PhaseName))
+	folder := filepath.Join(phaseFolder, m.Issue.SortID)
+	files, err := ioutil.ReadDir(phaseFolder)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Cannot read folder '%s': %v", phaseFolder, err)
+	}
+	names := []string{}
+	for _, file := range files {
+		if file.IsDir() && strings.HasPrefix(file.Name(), m.Issue.SortID) {
+			names = append(names, file.Name())
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		folder = filepath.Join(phaseFolder, names[0])
+	}
+
+	m.Target = filepath.Join(folder, filepath.Base(m.File.Path))
+	if filepath.Clean(m.File.Path) == m.Target {
+		return nil
+	}
+	if _, err := os.Stat(m.Target); err == nil {
+		fmt.Printf("[Skipping] %s already exists\n", m.Target)
+		return nil
+	}
+	err = os.MkdirAll(folder, 0755)
+	if err != nil {
+		return fmt.Errorf("Cannot create folder '%s': %v", folder, err)
+	}
+	fmt.Printf("[Moving] %s to %s\n", m.File.Path, m.Target)
+	err = os.Rename(m.File.Path, m.Target)
+	if err != nil {
+		return fmt.Errorf("Cannot move '%s': %v", m.File.Path, err)
+	}
+	m.Moved = true
+	return nil
+}
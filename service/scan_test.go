@@ -0,0 +1,64 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want LibraryFile
+	}{
+		{"vol and number", "Amazing Spider-Man v2 #030 (1999).cbz", LibraryFile{Collection: "Amazing Spider-Man", Vol: 2, Num: 30, Source: "filename"}},
+		{"vol spelled out", "Amazing Spider-Man Vol. 2 030.cbr", LibraryFile{Collection: "Amazing Spider-Man", Vol: 2, Num: 30, Source: "filename"}},
+		{"underscores", "X-Men_Annual_v1_1997.cbz", LibraryFile{Collection: "X-Men Annual", Vol: 1, Num: 1997, Source: "filename"}},
+		{"no vol", "Siege #002 (2010) (Digital).pdf", LibraryFile{Collection: "Siege", Num: 2, Source: "filename"}},
+		{"point one", "Avengers v4 #0.1 [Group].cbz", LibraryFile{Collection: "Avengers", Vol: 4, Num: 0.1, Source: "filename"}},
+		{"half issue", "Avengers #1.5.cbz", LibraryFile{Collection: "Avengers", Num: 1.5, Source: "filename"}},
+		{"negative", "Deadpool -1.cbr", LibraryFile{Collection: "Deadpool", Num: -1, Source: "filename"}},
+		{"no number", "Siege Prologue.cbz", LibraryFile{}},
+		{"only tags", "(2010) [Group].cbz", LibraryFile{}},
+	}
+	for _, e := range tests {
+		e.want.Path = e.path
+		got := parseFileName(e.path)
+		if !reflect.DeepEqual(got, e.want) {
+			t.Errorf("%s: expected %+v, got %+v", e.name, e.want, got)
+		}
+	}
+}
+
+func TestIssueIndexFind(t *testing.T) {
+	index := newIssueIndex([]LibraryIssue{
+		{Collection: "Amazing Spider-Man", Vol: 1, Num: 30},
+		{Collection: "Amazing Spider-Man", Vol: 2, Num: 30},
+		{Collection: "X-Men Annual", Vol: 1, Num: 1997},
+		{Collection: "Thor", Vol: 1, Num: 1},
+		{Collection: "Avengers", Vol: 4, Num: 0.1},
+	})
+	tests := []struct {
+		name  string
+		file  LibraryFile
+		want  int
+		found bool
+	}{
+		{"vol", LibraryFile{Collection: "Amazing Spider-Man", Vol: 2, Num: 30}, 1, true},
+		{"case and punctuation", LibraryFile{Collection: "amazing spider man", Vol: 1, Num: 30}, 0, true},
+		{"annual year", LibraryFile{Collection: "X-Men: Annual", Vol: 1, Num: 1997}, 2, true},
+		{"no vol, one issue", LibraryFile{Collection: "Thor", Num: 1}, 3, true},
+		{"wrong vol, one issue", LibraryFile{Collection: "Thor", Vol: 3, Num: 1}, 3, true},
+		{"point one", LibraryFile{Collection: "Avengers", Num: 0.1}, 4, true},
+		{"no vol, several issues", LibraryFile{Collection: "Amazing Spider-Man", Num: 30}, 0, false},
+		{"other number", LibraryFile{Collection: "Thor", Vol: 1, Num: 2}, 0, false},
+		{"other collection", LibraryFile{Collection: "Hulk", Vol: 1, Num: 1}, 0, false},
+		{"no collection", LibraryFile{Num: 1}, 0, false},
+	}
+	for _, e := range tests {
+		got, found := index.find(e.file)
+		if found != e.found || got != e.want {
+			t.Errorf("%s: expected %v (%v), got %v (%v)", e.name, e.want, e.found, got, found)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Search result types
+const (
+	SearchComic     = "comic"
+	SearchCharacter = "character"
+	SearchCreator   = "creator"
+	SearchEvent     = "event"
+)
+
+// Field weights used for ranking
+const (
+	nameWeight       = 4.0
+	titleWeight      = 3.0
+	collectionWeight = 2.0
+	relatedWeight    = 1.5
+	commentWeight    = 1.0
+	prefixFactor     = 0.5
+)
+
+// Search results
+type SearchResult struct {
+	Type      string  `json:"type"`
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Link      string  `json:"link"`
+	Score     float64 `json:"score"`
+	Title     string  `json:"title,omitempty"`     // Only comics
+	Pic       string  `json:"pic,omitempty"`       // Only comics
+	PhaseID   string  `json:"phaseid,omitempty"`   // Only comics
+	SortID    string  `json:"sortid,omitempty"`    // Only comics
+	Essential bool    `json:"essential,omitempty"` // Only comics
+}
+
+type Search struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+}
+
+func (s *Search) ToJson() ([]byte, error) {
+	return json.MarshalIndent(s, "", "	")
+}
+
+func (s *Search) IsEmpty() bool {
+	return s.Query == ""
+}
+
+// In-memory inverted index
+type SearchIndex struct {
+	docs     []SearchResult
+	postings map[string]map[int]float64
+	tokens   []string
+}
+
+// Build search index from the loaded dataset
+func NewSearchIndex(comics *ComicList, characters, creators, events *NamableList) *SearchIndex {
+	s := &SearchIndex{postings: map[string]map[int]float64{}}
+	for _, c := range *comics {
+		d := s.add(SearchResult{
+			Type:      SearchComic,
+			ID:        c.ID,
+			Name:      fmt.Sprintf("%s vol. %v #%v", c.Collection, c.Vol, c.Num),
+			Link:      fmt.Sprintf("/phases/%s/issues/%s", c.PhaseID, c.SortID),
+			Title:     c.Title,
+			Pic:       c.Pic,
+			PhaseID:   c.PhaseID,
+			SortID:    c.SortID,
+			Essential: c.Essential,
+		})
+		s.index(d, c.Title, titleWeight)
+		s.index(d, c.Collection, collectionWeight)
+		s.index(d, c.Event, relatedWeight)
+		for _, ch := range c.Characters {
+			s.index(d, ch.Name, relatedWeight)
+		}
+		for _, cr := range c.Creators {
+			s.index(d, cr.Name, relatedWeight)
+		}
+		for _, co := range c.Comments {
+			s.index(d, co, commentWeight)
+		}
+	}
+	s.addNamables(characters, SearchCharacter, "characters")
+	s.addNamables(creators, SearchCreator, "creators")
+	s.addNamables(events, SearchEvent, "events")
+	for t := range s.postings {
+		s.tokens = append(s.tokens, t)
+	}
+	sort.Strings(s.tokens)
+	return s
+}
+
+// Find documents matching all terms in q, best matches first
+func (s *SearchIndex) Search(q string) *Search {
+	result := &Search{Query: strings.TrimSpace(q), Results: []SearchResult{}}
+	terms := Tokenize(q)
+	if len(terms) <= 0 {
+		return result
+	}
+	var scores map[int]float64
+	for _, t := range terms {
+		matches := s.match(t)
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		for d, score := range scores {
+			m, found := matches[d]
+			if !found {
+				delete(scores, d)
+				continue
+			}
+			scores[d] = score + m
+		}
+	}
+	for d, score := range scores {
+		r := s.docs[d]
+		r.Score = score
+		result.Results = append(result.Results, r)
+	}
+	sort.Sort(byScore(result.Results))
+	result.Total = len(result.Results)
+	return result
+}
+
+// Lower case, accent-free words of s
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (s *SearchIndex) addNamables(namables *NamableList, t, link string) {
+	for _, n := range *namables {
+		d := s.add(SearchResult{
+			Type: t,
+			ID:   n.ID,
+			Name: n.Name,
+			Link: fmt.Sprintf("/%s/%s", link, n.ID),
+		})
+		s.index(d, n.Name, nameWeight)
+	}
+}
+
+func (s *SearchIndex) add(r SearchResult) int {
+	s.docs = append(s.docs, r)
+	return len(s.docs) - 1
+}
+
+func (s *SearchIndex) index(d int, text string, weight float64) {
+	for _, t := range Tokenize(text) {
+		p, exists := s.postings[t]
+		if !exists {
+			p = map[int]float64{}
+			s.postings[t] = p
+		}
+		if weight > p[d] {
+			p[d] = weight
+		}
+	}
+}
+
+// Exact matches score full weight, prefix matches score less
+func (s *SearchIndex) match(term string) map[int]float64 {
+	result := map[int]float64{}
+	for i := sort.SearchStrings(s.tokens, term); i < len(s.tokens); i++ {
+		t := s.tokens[i]
+		if !strings.HasPrefix(t, term) {
+			break
+		}
+		factor := 1.0
+		if t != term {
+			factor = prefixFactor
+		}
+		for d, w := range s.postings[t] {
+			if w*factor > result[d] {
+				result[d] = w * factor
+			}
+		}
+	}
+	return result
+}
+
+type byScore []SearchResult
+
+func (a byScore) Len() int      { return len(a) }
+func (a byScore) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byScore) Less(i, j int) bool {
+	if a[i].Score != a[j].Score {
+		return a[i].Score > a[j].Score
+	}
+	if a[i].Type != a[j].Type {
+		return a[i].Type < a[j].Type
+	}
+	if a[i].Name != a[j].Name {
+		return a[i].Name < a[j].Name
+	}
+	return a[i].ID < a[j].ID
+}
+
+// Accents
+var accents = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ę': 'e', 'ě': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i',
+	'ñ': 'n', 'ń': 'n', 'ň': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u', 'ů': 'u',
+	'ý': 'y', 'ÿ': 'y',
+	'ś': 's', 'š': 's', 'ß': 's',
+	'ź': 'z', 'ż': 'z', 'ž': 'z',
+	'ł': 'l', 'ř': 'r', 'ť': 't', 'ď': 'd',
+}
+
+func fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if a, exists := accents[r]; exists {
+			return a
+		}
+		return r
+	}, s)
+}
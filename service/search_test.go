@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func searchIndex() *SearchIndex {
+	comics := ComicList{
+		{ID: "1", Collection: "Siege", Vol: 1, Num: 1, Title: "Siege", Event: "Siege", PhaseID: "001", SortID: "001",
+			Characters: NamableList{{ID: "001", Name: "Thor"}}, Creators: NamableList{{ID: "001", Name: "Brian Michael Bendis"}},
+			Comments: []string{"Asgard falls"}},
+		{ID: "2", Collection: "Thor", Vol: 1, Num: 600, Title: "Thor", PhaseID: "001", SortID: "002",
+			Characters: NamableList{{ID: "001", Name: "Thor"}, {ID: "002", Name: "Loki"}}},
+		{ID: "3", Collection: "Amazing Spider-Man", Vol: 1, Num: 601, Title: "Amazing Spider-Man", PhaseID: "001", SortID: "003",
+			Characters: NamableList{{ID: "003", Name: "Spider-Man"}}, Creators: NamableList{{ID: "002", Name: "José Villarrubia"}}},
+	}
+	characters := NamableList{{ID: "001", Name: "Thor"}, {ID: "002", Name: "Loki"}, {ID: "003", Name: "Spider-Man"}}
+	creators := NamableList{{ID: "001", Name: "Brian Michael Bendis"}, {ID: "002", Name: "José Villarrubia"}}
+	events := NamableList{{ID: "001", Name: "Siege"}}
+	return NewSearchIndex(&comics, &characters, &creators, &events)
+}
+
+func TestSearch(t *testing.T) {
+	s := searchIndex()
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"empty", "  ", []string{}},
+		{"no match", "hulk", []string{}},
+		{"name over title over related", "thor", []string{"character 001 4", "comic 2 3", "comic 1 1.5"}},
+		{"prefix scores half", "tho", []string{"character 001 2", "comic 2 1.5", "comic 1 0.75"}},
+		{"best field only", "siege", []string{"event 001 4", "comic 1 3"}},
+		{"all terms", "thor loki", []string{"comic 2 4.5"}},
+		{"terms add up", "spider man", []string{"character 003 8", "comic 3 6"}},
+		{"comments", "asgard", []string{"comic 1 1"}},
+		{"accents folded", "jose", []string{"creator 002 4", "comic 3 1.5"}},
+		{"case and accents in query", "JOSÉ", []string{"creator 002 4", "comic 3 1.5"}},
+		{"punctuation", "spider-man!", []string{"character 003 8", "comic 3 6"}},
+	}
+	for _, e := range tests {
+		r := s.Search(e.query)
+		got := []string{}
+		for _, d := range r.Results {
+			got = append(got, fmt.Sprintf("%s %s %v", d.Type, d.ID, d.Score))
+		}
+		if !reflect.DeepEqual(got, e.want) || r.Total != len(e.want) {
+			t.Errorf("%s: expected %q, got %q (%v)", e.name, e.want, got, r.Total)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", []string{}},
+		{"Spider-Man", []string{"spider", "man"}},
+		{"  Amazing Spider-Man vol. 2 #30 ", []string{"amazing", "spider", "man", "vol", "2", "30"}},
+		{"Doña Ñoño Müller Łukasz", []string{"dona", "nono", "muller", "lukasz"}},
+		{"Eric O'Grady", []string{"eric", "o", "grady"}},
+	}
+	for _, e := range tests {
+		got := append([]string{}, Tokenize(e.s)...)
+		if !reflect.DeepEqual(got, e.want) {
+			t.Errorf("'%s': expected %q, got %q", e.s, e.want, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"github.com/tealeg/xlsx"
+)
+
+// XLSX row with a collection, as the JSON generator reads it
+// Titles are numbered in sheet order, from 1, and start on their first row
+type sheetRow struct {
+	Line        int // In the sheet, the header being 1
+	ID          string
+	Collection  string
+	Vol         int
+	Num         float64
+	Title       string
+	Date        string
+	Event       string
+	Characters  string // As in the cell, split by ', '
+	Creators    string // As in the cell, 'Name (role)' split by ', '
+	Pic         string
+	Universe    string
+	Essential   bool
+	Comments    string // Optional column
+	Protagonist string // Optional column
+	SortID      int
+	NewTitle    bool
+	New         bool // No id yet, and not filled red to be left alone
+}
+
+// Rows of one sheet, which is one phase
+// Rows with no collection are skipped, they are no comic
+func readSheet(sheet *xlsx.Sheet) ([]sheetRow, error) {
+	rows := []sheetRow{}
+	lastTitle := ""
+	sortID := 0
+	for row_i, row := range sheet.Rows[1:] {
+		r := sheetRow{Line: row_i + 2}
+		var err error
+		r.ID, err = row.Cells[id_col].String()
+		if err != nil {
+			return nil, err
+		}
+		fill := row.Cells[id_col].GetStyle().Fill
+		r.New = r.ID == "" && fill.PatternType != "solid" && fill.FgColor != "FFFF0000"
+		r.Collection, err = row.Cells[collection_col].String()
+		if err != nil {
+			return nil, err
+		}
+		if r.Collection == "" {
+			continue
+		}
+		r.Vol, err = row.Cells[vol_col].Int()
+		if err != nil {
+			return nil, err
+		}
+		r.Num, err = row.Cells[num_col].Float()
+		if err != nil {
+			return nil, err
+		}
+		r.Title, err = row.Cells[title_col].String()
+		if err != nil {
+			return nil, err
+		}
+		r.Date, err = row.Cells[date_col].String()
+		if err != nil {
+			return nil, err
+		}
+		r.Event, err = row.Cells[event_col].String()
+		if err != nil {
+			return nil, err
+		}
+		r.Characters, err = row.Cells[characters_col].String()
+		if err != nil {
+			return nil, err
+		}
+		r.Creators, err = row.Cells[creators_col].String()
+		if err != nil {
+			return nil, err
+		}
+		r.Pic, err = row.Cells[pic_col].String()
+		if err != nil {
+			return nil, err
+		}
+		r.Universe, err = row.Cells[universe_col].String()
+		if err != nil {
+			return nil, err
+		}
+		essential, err := row.Cells[essential_col].String()
+		if err != nil {
+			return nil, err
+		}
+		r.Essential = essential == "YES"
+		if len(row.Cells) > mandatory_cols {
+			r.Comments, err = row.Cells[comments_col].String()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(row.Cells) > protagonist_col {
+			r.Protagonist, err = row.Cells[protagonist_col].String()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if r.Title != lastTitle {
+			sortID++
+			lastTitle = r.Title
+			r.NewTitle = true
+		}
+		r.SortID = sortID
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	DefaultStatsTop = 10
+	MaxStatsTop     = 100
+)
+
+// Issues and titles (sortid groups) of a phase, event, character, creator or year
+type StatsCount struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Issues     int     `json:"issues"`
+	Titles     int     `json:"titles"`
+	Essentials int     `json:"essentials"`
+	Average    float64 `json:"average"` // Issues per title
+}
+
+type Stats struct {
+	Issues     int          `json:"issues"`
+	Titles     int          `json:"titles"`
+	Essentials int          `json:"essentials"`
+	Percent    float64      `json:"percent"` // Essential issues
+	Average    float64      `json:"average"` // Issues per title
+	Undated    int          `json:"undated"`
+	Phases     []StatsCount `json:"phases"`
+	Events     []StatsCount `json:"events"`
+	Characters []StatsCount `json:"characters"` // Most appearances first
+	Creators   []StatsCount `json:"creators"`   // Most appearances first
+	Years      []StatsCount `json:"years"`      // By publication year
+}
+
+// Only essential comics, and how many characters and creators
+type StatsQuery struct {
+	Essentials bool
+	Top        int
+}
+
+func (s *Stats) ToJson() ([]byte, error) {
+	return json.MarshalIndent(s, "", "	")
+}
+
+func (s *Stats) IsEmpty() bool {
+	return s.Issues == 0
+}
+
+func NewStatsQuery(v url.Values) (StatsQuery, error) {
+	q := StatsQuery{Essentials: v.Get("essentials") == "true", Top: DefaultStatsTop}
+	if top := v.Get("top"); top != "" {
+		n, err := strconv.Atoi(top)
+		if err != nil || n < 1 || n > MaxStatsTop {
+			return q, fmt.Errorf("Invalid top '%s': must be a number from 1 to %v", top, MaxStatsTop)
+		}
+		q.Top = n
+	}
+	return q, nil
+}
+
+// Counts per phase, event, character, creator and year
+// Phases and events in reading order, years in order
+func GetStats(comics *ComicList, q StatsQuery) *Stats {
+	s := &Stats{}
+	titles := map[string]bool{}
+	phases := newStatsCounts()
+	events := newStatsCounts()
+	characters := newStatsCounts()
+	creators := newStatsCounts()
+	years := newStatsCounts()
+	for _, c := range *comics {
+		if q.Essentials && !c.Essential {
+			continue
+		}
+		title := groupKey(c.PhaseID, c.SortID)
+		s.Issues++
+		titles[title] = true
+		if c.Essential {
+			s.Essentials++
+		}
+		phases.add(Namable{ID: c.PhaseID, Name: c.PhaseName}, title, c.Essential)
+		for _, e := range ComicEvent(&c) {
+			events.add(e, title, c.Essential)
+		}
+		for _, e := range c.Characters {
+			characters.add(e, title, c.Essential)
+		}
+		for _, e := range c.Creators {
+			creators.add(Namable{ID: e.ID, Name: e.Name}, title, c.Essential)
+		}
+		if c.Year() == 0 {
+			s.Undated++
+			continue
+		}
+		y := strconv.Itoa(c.Year())
+		years.add(Namable{ID: y, Name: y}, title, c.Essential)
+	}
+	s.Titles = len(titles)
+	s.Percent = percent(s.Essentials, s.Issues)
+	s.Average = average(s.Issues, s.Titles)
+	s.Phases = phases.list()
+	s.Events = events.list()
+	s.Characters = top(characters.list(), q.Top)
+	s.Creators = top(creators.list(), q.Top)
+	s.Years = years.list()
+	sort.SliceStable(s.Years, func(i, j int) bool { return s.Years[i].ID < s.Years[j].ID })
+	return s
+}
+
+type statsCounts struct {
+	order  []string
+	m      map[string]*StatsCount
+	titles map[string]map[string]bool
+}
+
+func newStatsCounts() *statsCounts {
+	return &statsCounts{m: make(map[string]*StatsCount), titles: make(map[string]map[string]bool)}
+}
+
+func (c *statsCounts) add(n Namable, title string, essential bool) {
+	e, exists := c.m[n.ID]
+	if !exists {
+		e = &StatsCount{ID: n.ID, Name: n.Name}
+		c.m[n.ID] = e
+		c.titles[n.ID] = make(map[string]bool)
+		c.order = append(c.order, n.ID)
+	}
+	e.Issues++
+	if essential {
+		e.Essentials++
+	}
+	c.titles[n.ID][title] = true
+}
+
+func (c *statsCounts) list() []StatsCount {
+	l := []StatsCount{}
+	for _, id := range c.order {
+		e := c.m[id]
+		e.Titles = len(c.titles[id])
+		e.Average = average(e.Issues, e.Titles)
+		l = append(l, *e)
+	}
+	return l
+}
+
+// First n with most issues, by name when even
+func top(l []StatsCount, n int) []StatsCount {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Issues != l[j].Issues {
+			return l[i].Issues > l[j].Issues
+		}
+		return l[i].Name < l[j].Name
+	})
+	if len(l) > n {
+		l = l[:n]
+	}
+	return l
+}
+
+// Rounded to 1 decimal
+func average(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*10/float64(total)) / 10
+}
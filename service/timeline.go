@@ -0,0 +1,149 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Issue as published, and where it is in the reading order
+type TimelineIssue struct {
+	ID         string `json:"id,omitempty"`
+	Title      string `json:"title"`
+	Issue      string `json:"issue"`
+	Date       string `json:"date"`
+	PhaseID    string `json:"phaseid"`
+	PhaseName  string `json:"phasename"`
+	SortID     string `json:"sortid"`
+	EventID    string `json:"eventid,omitempty"`
+	Event      string `json:"event,omitempty"`
+	Essential  bool   `json:"essential,omitempty"`
+	OutOfOrder bool   `json:"outoforder,omitempty"`
+}
+
+// Issues published in a month, 'YYYY-MM'
+type TimelineMonth struct {
+	Month  string          `json:"month"`
+	Issues []TimelineIssue `json:"issues"`
+}
+
+type Timeline struct {
+	Issues     int             `json:"issues"`
+	OutOfOrder int             `json:"outoforder"`
+	Undated    int             `json:"undated"`
+	Months     []TimelineMonth `json:"months"`
+}
+
+// Comics in the timeline, as in the comics list, and if only those out of order
+type TimelineQuery struct {
+	ListQuery
+	OutOfOrder bool
+}
+
+func (t *Timeline) ToJson() ([]byte, error) {
+	return json.MarshalIndent(t, "", "	")
+}
+
+func (t *Timeline) IsEmpty() bool {
+	return t.Issues == 0
+}
+
+func NewTimelineQuery(v url.Values) (TimelineQuery, error) {
+	l, err := NewListQuery(v)
+	if err != nil {
+		return TimelineQuery{}, err
+	}
+	q := TimelineQuery{ListQuery: l}
+	if s := v.Get("out_of_order"); s != "" {
+		q.OutOfOrder, err = strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("Invalid out_of_order '%s': must be true or false", s)
+		}
+	}
+	return q, nil
+}
+
+// Comics by publication month
+// Out of order is against the whole reading order, whatever the filters
+func GetTimeline(comics *ComicList, q TimelineQuery) *Timeline {
+	l := append(ComicList{}, *comics...)
+	less, _ := comicSorter(l, "order")
+	sort.SliceStable(l, less)
+	misplaced := outOfOrder(l)
+
+	t := &Timeline{Months: []TimelineMonth{}}
+	issues := []TimelineIssue{}
+	for i, c := range l {
+		if !q.Match(&c) || (q.OutOfOrder && !misplaced[i]) {
+			continue
+		}
+		if len(c.Date) < 7 {
+			t.Undated++
+			continue
+		}
+		issues = append(issues, TimelineIssue{
+			ID:         c.ID,
+			Title:      c.Title,
+			Issue:      IssueRange{Collection: c.Collection, Vol: c.Vol, From: c.Num, To: c.Num}.String(),
+			Date:       c.Date,
+			PhaseID:    c.PhaseID,
+			PhaseName:  c.PhaseName,
+			SortID:     c.SortID,
+			EventID:    c.EventID,
+			Event:      c.Event,
+			Essential:  c.Essential,
+			OutOfOrder: misplaced[i],
+		})
+		if misplaced[i] {
+			t.OutOfOrder++
+		}
+	}
+	t.Issues = len(issues)
+
+	// Same date stays in reading order
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Date < issues[j].Date })
+	for _, e := range issues {
+		month := e.Date[:7]
+		if n := len(t.Months); n == 0 || t.Months[n-1].Month != month {
+			t.Months = append(t.Months, TimelineMonth{Month: month})
+		}
+		t.Months[len(t.Months)-1].Issues = append(t.Months[len(t.Months)-1].Issues, e)
+	}
+	return t
+}
+
+// Dated comics, in reading order, not in the longest run of non decreasing dates
+// Those are the fewest rows to move for dates to follow the reading order
+func outOfOrder(l ComicList) map[int]bool {
+	tails := []int{} // Last comic of the best run of each length
+	prev := make(map[int]int)
+	for i, c := range l {
+		if len(c.Date) < 7 {
+			continue
+		}
+		n := sort.Search(len(tails), func(j int) bool { return l[tails[j]].Date > c.Date })
+		if n > 0 {
+			prev[i] = tails[n-1]
+		}
+		if n == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[n] = i
+		}
+	}
+	inRun := make(map[int]bool)
+	if len(tails) > 0 {
+		for i, ok := tails[len(tails)-1], true; ok; i, ok = prev[i] {
+			inRun[i] = true
+		}
+	}
+	misplaced := make(map[int]bool)
+	for i, c := range l {
+		if len(c.Date) >= 7 && !inRun[i] {
+			misplaced[i] = true
+		}
+	}
+	return misplaced
+}
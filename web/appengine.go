@@ -0,0 +1,19 @@
+//go:build appengine
+// +build appengine
+
+package web
+
+import (
+	"log"
+	"net/http"
+)
+
+// App Engine serves static files itself, see app.yaml
+// No progress nor lists: their writes are only for local use
+func init() {
+	handler, err := NewHandler(Config{DataFolder: "data", WebFolder: "html"})
+	if err != nil {
+		log.Fatalf("[Error] Cannot start: %v", err)
+	}
+	http.Handle("/", handler)
+}
@@ -0,0 +1,149 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stop caching past this, so random query strings cannot grow it forever
+const maxCacheEntries = 5000
+
+// Rendered responses for one dataset
+// Reloads build a new dataset, which starts with an empty cache
+type pageCache struct {
+	sync.RWMutex
+	modified time.Time
+	entries  map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	contentType string
+	body        []byte
+	gzipped     []byte
+	etag        string
+}
+
+func newPageCache(modified time.Time) *pageCache {
+	return &pageCache{
+		modified: modified.Truncate(time.Second),
+		entries:  make(map[string]*cacheEntry),
+	}
+}
+
+// Path plus sorted query, so '?essentials=true' pages are kept apart
+func cacheKey(r *http.Request) string {
+	return fmt.Sprintf("%s?%s", r.URL.Path, r.URL.Query().Encode())
+}
+
+// Write cached response for r, if there is one
+// A nil cache never has anything
+func (c *pageCache) serve(w http.ResponseWriter, r *http.Request) bool {
+	if c == nil || r.Method != http.MethodGet {
+		return false
+	}
+	c.RLock()
+	e, exists := c.entries[cacheKey(r)]
+	c.RUnlock()
+	if !exists {
+		return false
+	}
+	c.send(w, r, e)
+	return true
+}
+
+// Cache body for r and write it
+// A nil cache writes it as it is
+func (c *pageCache) write(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	if c == nil || r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		return
+	}
+	e, err := newCacheEntry(contentType, body)
+	if err != nil {
+		// Still worth serving uncompressed
+		e = &cacheEntry{contentType: contentType, body: body, etag: etag(body)}
+	}
+	c.Lock()
+	if len(c.entries) < maxCacheEntries {
+		c.entries[cacheKey(r)] = e
+	}
+	c.Unlock()
+	c.send(w, r, e)
+}
+
+func (c *pageCache) send(w http.ResponseWriter, r *http.Request, e *cacheEntry) {
+	h := w.Header()
+	h.Set("Content-Type", e.contentType)
+	h.Set("Last-Modified", c.modified.UTC().Format(http.TimeFormat))
+	h.Set("Cache-Control", "no-cache")
+	h.Add("Vary", "Accept-Encoding")
+	body, tag := e.body, e.etag
+	if e.gzipped != nil && acceptsGzip(r) {
+		// Different bytes, different tag
+		body, tag = e.gzipped, fmt.Sprintf("%s-gz\"", strings.TrimSuffix(e.etag, "\""))
+		h.Set("Content-Encoding", "gzip")
+	}
+	h.Set("ETag", tag)
+	if notModified(r, tag, c.modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", fmt.Sprintf("%v", len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func newCacheEntry(contentType string, body []byte) (*cacheEntry, error) {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	_, err := gz.Write(body)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &cacheEntry{contentType: contentType, body: body, gzipped: b.Bytes(), etag: etag(body)}, nil
+}
+
+func etag(body []byte) string {
+	return fmt.Sprintf("\"%x\"", sha1.Sum(body))
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, e := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		e = strings.TrimSpace(e)
+		if e == "gzip" || strings.HasPrefix(e, "gzip;") && !strings.HasSuffix(e, "q=0") {
+			return true
+		}
+	}
+	return false
+}
+
+// If-None-Match wins over If-Modified-Since
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	match := r.Header.Get("If-None-Match")
+	if match != "" {
+		for _, e := range strings.Split(match, ",") {
+			e = strings.TrimPrefix(strings.TrimSpace(e), "W/")
+			if e == "*" || e == tag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
@@ -0,0 +1,328 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/adriwankenobi/comic/service"
+	"github.com/elgs/jsonql"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type jsonContent map[string]*jsonql.JSONQL
+
+// Files the site cannot run without
+var requiredJsonFiles = []string{"comics", "phases", "events", "characters", "creators",
+	"fissues-phases", "fissues-events", "fissues-characters", "fissues-creators"}
+
+// Everything loaded from the data folder of a catalogue
+// Never modified once built, reloads swap in a new one
+type dataset struct {
+	catalog  *catalog
+	json     jsonContent
+	menu     service.Menu
+	comics   *service.ComicList
+	groups   service.ComicGroups
+	index    *service.SearchIndex
+	files    int
+	loadedAt time.Time
+	cache    *pageCache
+}
+
+// Catalogue served under '/c/:catalog', with its own data folder
+// Progress and lists are nil to disable them
+type Catalog struct {
+	Name       string
+	Title      string
+	DataFolder string
+	Progress   service.ProgressStore
+	Lists      service.ReadingListStore
+}
+
+// Catalogue and its dataset in use
+type catalog struct {
+	Catalog
+	pages      *pages // Templates of the handler serving it
+	current    atomic.Value
+	reloading  sync.Mutex
+	lastReload atomic.Value
+}
+
+// Catalogues of one handler, the first one also served at '/'
+type catalogSet struct {
+	byName map[string]*catalog
+	first  *catalog
+	list   service.NamableList // ID is the name, default one first
+}
+
+type contextKey int
+
+const catalogsKey contextKey = 0
+
+// Load all catalogues, the default one is also served at '/'
+func loadCatalogs(all []Catalog, pg *pages) (*catalogSet, error) {
+	set := &catalogSet{byName: make(map[string]*catalog), list: service.NamableList{}}
+	for i, e := range all {
+		err := service.ValidateCatalogName(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := set.byName[e.Name]; exists {
+			return nil, fmt.Errorf("Catalogue '%s' is already used", e.Name)
+		}
+		if i > 0 && ((e.Progress == nil) != (all[0].Progress == nil) || (e.Lists == nil) != (all[0].Lists == nil)) {
+			return nil, fmt.Errorf("Catalogue '%s' must track progress and lists as '%s' does", e.Name, all[0].Name)
+		}
+		c := &catalog{Catalog: e, pages: pg}
+		err = c.reload()
+		if err != nil {
+			return nil, err
+		}
+		set.byName[e.Name] = c
+		set.list = append(set.list, service.Namable{ID: e.Name, Name: e.Title})
+	}
+	set.first = set.byName[all[0].Name]
+	return set, nil
+}
+
+// Request carrying the catalogues of the handler serving it
+func withCatalogs(r *http.Request, set *catalogSet) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), catalogsKey, set))
+}
+
+func catalogsOf(r *http.Request) *catalogSet {
+	return r.Context().Value(catalogsKey).(*catalogSet)
+}
+
+// Catalogue of this request, from its '/c/:catalog' prefix
+// Nil when there is no such catalogue
+func findCatalog(r *http.Request) *catalog {
+	set := catalogsOf(r)
+	if !strings.HasPrefix(r.URL.Path, "/c/") {
+		return set.first
+	}
+	return set.byName[strings.SplitN(r.URL.Path[len("/c/"):], "/", 2)[0]]
+}
+
+// Prefix of links for the pages of this request
+func catalogBase(r *http.Request) string {
+	c := findCatalog(r)
+	if c == nil || !strings.HasPrefix(r.URL.Path, "/c/") {
+		return ""
+	}
+	return fmt.Sprintf("/c/%s", c.Name)
+}
+
+// Dataset in use by the catalogue of this request
+// The default one when there is no such catalogue, validateParams turns those into 404
+func data(r *http.Request) *dataset {
+	c := findCatalog(r)
+	if c == nil {
+		c = catalogsOf(r).first
+	}
+	return c.data()
+}
+
+func (c *catalog) data() *dataset {
+	return c.current.Load().(*dataset)
+}
+
+// Load data folder and swap it in, keeping the old dataset on failure
+// Only one reload runs at a time
+func (c *catalog) reload() error {
+	c.reloading.Lock()
+	defer c.reloading.Unlock()
+	d, err := load(c.DataFolder)
+	result := reloadResult{At: time.Now().UTC().Format(time.RFC3339)}
+	if err != nil {
+		result.Error = err.Error()
+		c.lastReload.Store(result)
+		return err
+	}
+	d.catalog = c
+	c.current.Store(d)
+	c.lastReload.Store(result)
+	return nil
+}
+
+// Poll data folder, reloading once changes settle
+func (c *catalog) watch(interval time.Duration) {
+	folder := c.DataFolder
+	last, _ := signature(folder)
+	pending := ""
+	for range time.Tick(interval) {
+		s, err := signature(folder)
+		if err != nil || s == last {
+			pending = ""
+			continue
+		}
+		// Wait one more tick: -generate writes files one by one
+		if s != pending {
+			pending = s
+			continue
+		}
+		fmt.Printf("[Reloading] %s\n", folder)
+		err = c.reload()
+		if err != nil {
+			log.Printf("[Error] Cannot reload '%s', keeping old data: %v", folder, err)
+		}
+		last = s
+		pending = ""
+	}
+}
+
+// Names, sizes and modification times of all JSON files in folder
+func signature(folder string) (string, error) {
+	files, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return "", err
+	}
+	s := []string{}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+			s = append(s, fmt.Sprintf("%s:%v:%v", f.Name(), f.Size(), f.ModTime().UnixNano()))
+		}
+	}
+	return strings.Join(s, "|"), nil
+}
+
+// Load all JSON files, checking nothing is missing
+func load(folder string) (*dataset, error) {
+	var err error
+	d := &dataset{}
+	d.json, err = readJsonFiles(folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range requiredJsonFiles {
+		if _, exists := d.json[name]; !exists {
+			return nil, fmt.Errorf("Missing file '%s/%s.json'", folder, name)
+		}
+	}
+
+	d.menu, err = service.GetMenu(d.json["phases"], d.json["events"], d.json["characters"])
+	if err != nil {
+		return nil, fmt.Errorf("Cannot build menu from '%s': %v", folder, err)
+	}
+	for _, p := range *d.menu.Phases {
+		name := fmt.Sprintf("comics-phase-%s", p.ID)
+		if _, exists := d.json[name]; !exists {
+			return nil, fmt.Errorf("Missing file '%s/%s.json' for phase '%s'", folder, name, p.Name)
+		}
+	}
+
+	d.comics, err = service.ListComics(d.json["comics"])
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read '%s/comics.json': %v", folder, err)
+	}
+	d.groups = service.GroupComics(d.comics)
+
+	d.index, err = newSearchIndex(d.json, d.comics)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot build search index from '%s': %v", folder, err)
+	}
+
+	d.files = len(d.json)
+	d.loadedAt = time.Now().UTC()
+	d.cache = newPageCache(d.loadedAt)
+	return d, nil
+}
+
+func readJsonFiles(folder string) (jsonContent, error) {
+	m := make(jsonContent)
+	files, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return m, fmt.Errorf("Cannot read folder '%s': %v", folder, err)
+	}
+	for _, f := range files {
+		split := strings.Split(f.Name(), ".")
+		if f.IsDir() || len(split) != 2 || split[1] != "json" {
+			continue
+		}
+		file := fmt.Sprintf("%s/%s", folder, f.Name())
+		bytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			return m, fmt.Errorf("Cannot read file '%s': %v", file, err)
+		}
+		query, err := jsonql.NewStringQuery(string(bytes))
+		if err != nil {
+			return m, fmt.Errorf("Cannot parse file '%s': %v", file, err)
+		}
+		m[split[0]] = query
+	}
+	return m, nil
+}
+
+// Search index
+func newSearchIndex(j jsonContent, comics *service.ComicList) (*service.SearchIndex, error) {
+	characters, err := service.ListNamables(j["characters"])
+	if err != nil {
+		return nil, err
+	}
+	creators, err := service.ListNamables(j["creators"])
+	if err != nil {
+		return nil, err
+	}
+	events, err := service.ListNamables(j["events"])
+	if err != nil {
+		return nil, err
+	}
+	return service.NewSearchIndex(comics, characters, creators, events), nil
+}
+
+// Health
+type reloadResult struct {
+	At    string `json:"at"`
+	Error string `json:"error,omitempty"`
+}
+
+func (r *reloadResult) ToJson() ([]byte, error) {
+	return json.MarshalIndent(r, "", "	")
+}
+
+func (r *reloadResult) IsEmpty() bool {
+	return r.At == ""
+}
+
+type healthStatus struct {
+	Status     string        `json:"status"`
+	Catalog    string        `json:"catalog"`
+	Files      int           `json:"files"`
+	Comics     int           `json:"comics"`
+	Phases     int           `json:"phases"`
+	LoadedAt   string        `json:"loadedat"`
+	LastReload *reloadResult `json:"lastreload,omitempty"`
+}
+
+func (h *healthStatus) ToJson() ([]byte, error) {
+	return json.MarshalIndent(h, "", "	")
+}
+
+func (h *healthStatus) IsEmpty() bool {
+	return h == nil
+}
+
+// Degraded when the last reload failed and old data is still served
+func (d *dataset) health() *healthStatus {
+	h := &healthStatus{
+		Status:   "ok",
+		Catalog:  d.catalog.Name,
+		Files:    d.files,
+		Comics:   len(*d.comics),
+		Phases:   len(*d.menu.Phases),
+		LoadedAt: d.loadedAt.Format(time.RFC3339),
+	}
+	if r, ok := d.catalog.lastReload.Load().(reloadResult); ok {
+		h.LastReload = &r
+		if r.Error != "" {
+			h.Status = "degraded"
+		}
+	}
+	return h
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+var codeRegexp = regexp.MustCompile("^[0-9]{3}$")
+var comicIDRegexp = regexp.MustCompile("^[0-9]+$")
+
+// Errors with HTTP status
+type httpError struct {
+	Code    int
+	Message string
+}
+
+func (e *httpError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &httpError{Code: http.StatusBadRequest, Message: fmt.Sprintf(format, a...)}
+}
+
+func notFound(format string, a ...interface{}) error {
+	return &httpError{Code: http.StatusNotFound, Message: fmt.Sprintf(format, a...)}
+}
+
+func unauthorized(format string, a ...interface{}) error {
+	return &httpError{Code: http.StatusUnauthorized, Message: fmt.Sprintf(format, a...)}
+}
+
+// Bearer token in Authorization header
+func authorized(r *http.Request, token string) bool {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// Status for err: 500 unless it says otherwise
+func errorCode(err error) int {
+	if e, ok := err.(*httpError); ok {
+		return e.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// Validators
+func validateCode(name, id string) error {
+	if !codeRegexp.MatchString(id) {
+		return badRequest("Invalid %s '%s': must be a 3 digit code", name, id)
+	}
+	return nil
+}
+
+func validateComicID(id string) error {
+	if !comicIDRegexp.MatchString(id) {
+		return badRequest("Invalid comic id '%s': must be numeric", id)
+	}
+	return nil
+}
+
+// Error envelope
+type errorBody struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestid"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+func writeJsonError(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorCode(err)
+	message := err.Error()
+	if code == http.StatusInternalServerError {
+		// Don't leak internals
+		log.Printf("[Error] %s %s (%s): %v", r.Method, r.URL.Path, requestID(w, r), err)
+		message = http.StatusText(code)
+	}
+	bytes, _ := json.MarshalIndent(errorResponse{errorBody{code, message, requestID(w, r)}}, "", "	")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(bytes)
+}
+
+// Request ID from the incoming header, or a new one
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := w.Header().Get(requestIDHeader)
+	if id != "" {
+		return id
+	}
+	id = r.Header.Get(requestIDHeader)
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = fmt.Sprintf("%x", b)
+	}
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
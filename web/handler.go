@@ -1,292 +1,1022 @@
 package web
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/adriwankenobi/comic/service"
 	"github.com/elgs/jsonql"
 	"github.com/julienschmidt/httprouter"
+	"html"
+	"html/template"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"path"
 	"strings"
+	"time"
 )
 
-type jsonHandler func(p httprouter.Params) (service.JsonAble, error)
-type webHandler func(r *http.Request, p httprouter.Params) (string, error)
+type jsonHandler func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error)
+type webHandler func(d *dataset, r *http.Request, p httprouter.Params) (string, error)
 
-type webContent map[string]string
-type jsonContent map[string]*jsonql.JSONQL
+// First issues datasets
+const (
+	fissuesPhases     = "phases"
+	fissuesEvents     = "events"
+	fissuesCharacters = "characters"
+	fissuesCreators   = "creators"
+)
+
+var fissuesAll = []string{fissuesPhases, fissuesEvents, fissuesCharacters, fissuesCreators}
+
+// Templates the site cannot run without
+var requiredTemplates = []string{"template", "intro", "about", "not-found", "error", "content",
+	"content-issues", "content-issue", "content-fissue", "next", "fissues", "creators", "search",
+	"search-result", "stats", "timeline", "a-link", "list", "ul", "div-left", "h6", "clear-fix"}
+
+// Static files, as served by app.yaml
+var staticExtensions = map[string]bool{
+	".css": true, ".map": true, ".js": true, ".txt": true, ".xml": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".svg": true, ".eot": true, ".otf": true,
+	".bmp": true, ".gif": true, ".ico": true, ".jpeg": true, ".jpg": true, ".png": true,
+}
+
+// Server configuration
+// Data folder, progress and lists are those of the default catalogue
+type Config struct {
+	Name          string // Default catalogue, 'marvel' if empty
+	Title         string // 'MARVEL' if empty
+	DataFolder    string // Generated JSON files
+	WebFolder     string // HTML fragments
+	StaticFolder  string // CSS, JS, fonts and images
+	Favicon       string
+	AdminToken    string                   // Enables POST /admin/reload, and is then needed to write progress and lists
+	Progress      service.ProgressStore    // Reading tracker, nil to disable
+	Lists         service.ReadingListStore // Custom reading lists, nil to disable
+	WatchInterval time.Duration            // Reload when data folder changes, 0 to disable
+	Catalogs      []Catalog                // Other catalogues, tracking progress and lists as the default one
+}
 
-var c webContent
-var j jsonContent
+// Every route is also served under '/c/:catalog' for any catalogue
+type catalogRouter struct {
+	*httprouter.Router
+}
+
+func (c catalogRouter) handle(method, path string, handle httprouter.Handle) {
+	c.Handle(method, path, handle)
+	c.Handle(method, strings.TrimSuffix(fmt.Sprintf("/c/:catalog%s", path), "/"), handle)
+}
+
+func (c catalogRouter) GET(path string, handle httprouter.Handle) {
+	c.handle("GET", path, handle)
+}
+
+func (c catalogRouter) POST(path string, handle httprouter.Handle) {
+	c.handle("POST", path, handle)
+}
 
-func init() {
-	// Read files
-	j, err := readJsonFiles()
+func (c catalogRouter) PUT(path string, handle httprouter.Handle) {
+	c.handle("PUT", path, handle)
+}
+
+func (c catalogRouter) DELETE(path string, handle httprouter.Handle) {
+	c.handle("DELETE", path, handle)
+}
+
+// Load all files and build the router
+// Refuses to start with a partial dataset
+func NewHandler(cfg Config) (http.Handler, error) {
+	templates, err := readWebFiles(cfg.WebFolder)
 	if err != nil {
-		return
+		return nil, err
 	}
-	c, err = readWebFiles()
-	if err != nil {
-		return
+	for _, name := range requiredTemplates {
+		if templates.Lookup(name) == nil {
+			return nil, fmt.Errorf("Missing template '%s' in '%s'", name, cfg.WebFolder)
+		}
 	}
-
-	menu, err := service.GetMenu(j["phases"], j["events"], j["characters"])
+	first := Catalog{Name: cfg.Name, Title: cfg.Title, DataFolder: cfg.DataFolder, Progress: cfg.Progress, Lists: cfg.Lists}
+	if first.Name == "" {
+		first.Name, first.Title = "marvel", "MARVEL"
+	}
+	set, err := loadCatalogs(append([]Catalog{first}, cfg.Catalogs...), &pages{templates: templates})
 	if err != nil {
-		return
+		return nil, err
+	}
+	if cfg.WatchInterval > 0 {
+		for _, c := range set.byName {
+			go c.watch(cfg.WatchInterval)
+		}
 	}
 
-	// Start server
-	router := httprouter.New()
+	router := catalogRouter{httprouter.New()}
 
 	// API
 
+	// Get all catalogues, the first one is also served at '/'
+	router.GET("/api/catalogs", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return &set.list, nil
+	}))
+
 	// Get all comics
-	router.GET("/api/comics", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListComics(j["comics"])
+	router.GET("/api/comics", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		q, err := service.NewListQuery(r.URL.Query())
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		page, err := service.QueryComics(d.comics, q)
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		return withNext(r, page), nil
 	}))
 
 	// Get this comic
-	router.GET("/api/comics/:id", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.FindComicByID(j["comics"], p.ByName("id"))
+	router.GET("/api/comics/:comicid", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindComicByID(d.json["comics"], p.ByName("comicid"))
 	}))
 
 	// Get all phases
-	router.GET("/api/phases", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListNamables(j["phases"])
+	router.GET("/api/phases", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.ListNamables(d.json["phases"])
 	}))
 
 	// Get this phase
-	router.GET("/api/phases/:id", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.FindNamableByID(j["phases"], p.ByName("id"))
+	router.GET("/api/phases/:id", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindNamableByID(d.json["phases"], p.ByName("id"))
 	}))
 
-	// Get all first issues from all phases
-	router.GET("/api/fissues", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListFirstIssues(j["fissues"])
+	// Get all first issues from all phases, events, characters and creators
+	// Optional 'type' parameter narrows it down to one of them
+	router.GET("/api/fissues", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		types, err := fissuesTypes(r.FormValue("type"), fissuesAll)
+		if err != nil {
+			return nil, err
+		}
+		all := service.FissuesMap{}
+		for _, t := range types {
+			list, err := service.ListFirstIssues(d.json[fmt.Sprintf("fissues-%s", t)])
+			if err != nil {
+				return nil, err
+			}
+			all[t] = list
+		}
+		return &all, nil
 	}))
 
 	// Get all first issues from this phase
-	router.GET("/api/fissues/:id", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.FindFirstIssuesByID(j["fissues"], p.ByName("id"))
+	// Optional 'type' parameter looks up an event, character or creator instead
+	router.GET("/api/fissues/:id", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		types, err := fissuesTypes(r.FormValue("type"), []string{fissuesPhases})
+		if err != nil {
+			return nil, err
+		}
+		return service.FindFirstIssuesByID(d.json[fmt.Sprintf("fissues-%s", types[0])], p.ByName("id"))
 	}))
 
 	// Get all issues from this phase
-	router.GET("/api/phases/:id/issues", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListComics(j[fmt.Sprintf("comics-phase-%s", p.ByName("id"))])
+	router.GET("/api/phases/:id/issues", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		issues, exists := d.json[fmt.Sprintf("comics-phase-%s", p.ByName("id"))]
+		if !exists {
+			return nil, notFound("Phase '%s' not found", p.ByName("id"))
+		}
+		return service.ListComics(issues)
 	}))
 
 	// Get all issues from this comic from this phase
-	router.GET("/api/phases/:id/issues/:sortid", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListComicsBySortID(j[fmt.Sprintf("comics-phase-%s", p.ByName("id"))], p.ByName("sortid"))
+	router.GET("/api/phases/:id/issues/:sortid", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		issues, exists := d.json[fmt.Sprintf("comics-phase-%s", p.ByName("id"))]
+		if !exists {
+			return nil, notFound("Phase '%s' not found", p.ByName("id"))
+		}
+		return service.ListComicsBySortID(issues, p.ByName("sortid"))
 	}))
 
 	// Get all events
-	router.GET("/api/events", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListNamables(j["events"])
+	router.GET("/api/events", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return queryNamables(d, r, d.json["events"], service.ComicEvent)
 	}))
 
 	// Get this event
-	router.GET("/api/events/:id", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.FindNamableByID(j["events"], p.ByName("id"))
+	router.GET("/api/events/:id", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindNamableByID(d.json["events"], p.ByName("id"))
+	}))
+
+	// Get all first issues from this event
+	router.GET("/api/events/:id/comics", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindFirstIssuesByID(d.json["fissues-events"], p.ByName("id"))
 	}))
 
 	// Get all characters
-	router.GET("/api/characters", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListNamables(j["characters"])
+	router.GET("/api/characters", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return queryNamables(d, r, d.json["characters"], service.ComicCharacters)
 	}))
 
 	// Get this character
-	router.GET("/api/characters/:id", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.FindNamableByID(j["characters"], p.ByName("id"))
+	router.GET("/api/characters/:id", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindNamableByID(d.json["characters"], p.ByName("id"))
+	}))
+
+	// Get all first issues from this character
+	router.GET("/api/characters/:id/comics", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindFirstIssuesByID(d.json["fissues-characters"], p.ByName("id"))
 	}))
 
 	// Get all creators
-	router.GET("/api/creators", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.ListNamables(j["creators"])
+	router.GET("/api/creators", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return queryNamables(d, r, d.json["creators"], service.ComicCreators)
 	}))
 
 	// Get this creator
-	router.GET("/api/creators/:id", jsonHandle(func(p httprouter.Params) (service.JsonAble, error) {
-		return service.FindNamableByID(j["creators"], p.ByName("id"))
+	router.GET("/api/creators/:id", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindNamableByID(d.json["creators"], p.ByName("id"))
+	}))
+
+	// Get all first issues from this creator
+	router.GET("/api/creators/:id/comics", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return service.FindFirstIssuesByID(d.json["fissues-creators"], p.ByName("id"))
+	}))
+
+	// Get issue counts per phase, event, character, creator and year
+	// Optional 'essentials' and 'top' parameters, top 10 characters and creators by default
+	router.GET("/api/stats", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		q, err := service.NewStatsQuery(r.URL.Query())
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		return service.GetStats(d.comics, q), nil
+	}))
+
+	// Get comics by publication month, flagging those out of reading order
+	// Same filters as '/api/comics', 'out_of_order' to get only those
+	router.GET("/api/timeline", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		q, err := service.NewTimelineQuery(r.URL.Query())
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		return service.GetTimeline(d.comics, q), nil
 	}))
 
+	// Dataset load status
+	router.GET("/healthz", liveJsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		return d.health(), nil
+	}))
+
+	// Reload data folder of this catalogue in the background
+	if cfg.AdminToken != "" {
+		router.POST("/admin/reload", liveJsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			if !authorized(r, cfg.AdminToken) {
+				return nil, unauthorized("Invalid admin token")
+			}
+			c := d.catalog
+			go func() {
+				err := c.reload()
+				if err != nil {
+					log.Printf("[Error] Cannot reload '%s', keeping old data: %v", c.DataFolder, err)
+				}
+			}()
+			return &reloadResult{At: time.Now().UTC().Format(time.RFC3339)}, nil
+		}))
+	}
+
+	// Search comics, characters, creators and events
+	router.GET("/api/search", jsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		q := r.FormValue("q")
+		if strings.TrimSpace(q) == "" {
+			return nil, badRequest("Query parameter 'q' cannot be empty")
+		}
+		return d.index.Search(q), nil
+	}))
+
+	// Get next comic to read, nothing read if progress is not tracked
+	// Optional 'essentials', 'character' and 'event' parameters narrow down the reading order
+	router.GET("/api/next", liveJsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		reader, err := apiReader(r)
+		if err != nil {
+			return nil, err
+		}
+		read := service.NewProgress(reader)
+		if d.catalog.Progress != nil {
+			read, err = d.catalog.Progress.Get(reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+		next := service.NextToRead(read, d.comics, service.NewNextQuery(r.URL.Query()))
+		if next.IsEmpty() {
+			return nil, notFound("No comics to read for these filters")
+		}
+		return next, nil
+	}))
+
+	if cfg.Progress != nil {
+		// Get completion per phase, event and character
+		router.GET("/api/progress", liveJsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			reader, err := apiReader(r)
+			if err != nil {
+				return nil, err
+			}
+			read, err := d.catalog.Progress.Get(reader)
+			if err != nil {
+				return nil, err
+			}
+			return service.GetProgressSummary(read, d.comics), nil
+		}))
+
+		// Mark this comic as read, or unread
+		markComic := func(read bool) jsonHandler {
+			return func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+				comic, err := service.FindComicByID(d.json["comics"], p.ByName("comicid"))
+				if err != nil {
+					return nil, err
+				}
+				if comic.IsEmpty() {
+					return nil, notFound("Comic '%s' not found", p.ByName("comicid"))
+				}
+				return markRead(d, r, service.ComicList{*comic}, read)
+			}
+		}
+		router.PUT("/api/progress/comics/:comicid", liveJsonHandle(guarded(cfg.AdminToken, markComic(true))))
+		router.DELETE("/api/progress/comics/:comicid", liveJsonHandle(guarded(cfg.AdminToken, markComic(false))))
+
+		// Mark all issues from this comic from this phase as read, or unread
+		markIssues := func(read bool) jsonHandler {
+			return func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+				phase, exists := d.json[fmt.Sprintf("comics-phase-%s", p.ByName("id"))]
+				if !exists {
+					return nil, notFound("Phase '%s' not found", p.ByName("id"))
+				}
+				issues, err := service.ListComicsBySortID(phase, p.ByName("sortid"))
+				if err != nil {
+					return nil, err
+				}
+				if issues.IsEmpty() {
+					return nil, notFound("Issues '%s' not found in phase '%s'", p.ByName("sortid"), p.ByName("id"))
+				}
+				return markRead(d, r, *issues, read)
+			}
+		}
+		router.PUT("/api/progress/phases/:id/issues/:sortid", liveJsonHandle(guarded(cfg.AdminToken, markIssues(true))))
+		router.DELETE("/api/progress/phases/:id/issues/:sortid", liveJsonHandle(guarded(cfg.AdminToken, markIssues(false))))
+	}
+
+	if cfg.Lists != nil {
+		// Get all reading lists, as JSON to import elsewhere
+		router.GET("/api/lists", liveJsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			return d.catalog.Lists.List()
+		}))
+
+		// Create reading list
+		router.POST("/api/lists", liveJsonHandle(guarded(cfg.AdminToken, func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			l := &service.ReadingList{}
+			err := readList(d, r, l)
+			if err != nil {
+				return nil, err
+			}
+			l.ID = ""
+			return l, d.catalog.Lists.Create(l)
+		})))
+
+		// Import reading lists, replacing the ones with the same id
+		router.POST("/api/lists/import", liveJsonHandle(guarded(cfg.AdminToken, func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			all := &service.ReadingLists{}
+			err := readJson(r, all)
+			if err != nil {
+				return nil, err
+			}
+			for i := range *all {
+				err = (*all)[i].Validate(d.comics, d.groups)
+				if err != nil {
+					return nil, badRequest("List %v: %v", i+1, err)
+				}
+			}
+			// Only once all of them are valid
+			for i := range *all {
+				l := &(*all)[i]
+				if l.ID == "" {
+					err = d.catalog.Lists.Create(l)
+				} else {
+					err = d.catalog.Lists.Save(l)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			return all, nil
+		})))
+
+		// Get this reading list
+		router.GET("/api/lists/:listid", liveJsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			return d.catalog.Lists.Get(p.ByName("listid"))
+		}))
+
+		// Replace this reading list
+		router.PUT("/api/lists/:listid", liveJsonHandle(guarded(cfg.AdminToken, func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			old, err := d.catalog.Lists.Get(p.ByName("listid"))
+			if err != nil {
+				return nil, err
+			}
+			if old.IsEmpty() {
+				return nil, notFound("List '%s' not found", p.ByName("listid"))
+			}
+			l := &service.ReadingList{}
+			err = readList(d, r, l)
+			if err != nil {
+				return nil, err
+			}
+			l.ID = old.ID
+			return l, d.catalog.Lists.Save(l)
+		})))
+
+		// Delete this reading list
+		router.DELETE("/api/lists/:listid", liveJsonHandle(guarded(cfg.AdminToken, func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			l, err := d.catalog.Lists.Get(p.ByName("listid"))
+			if err != nil || l.IsEmpty() {
+				return l, err
+			}
+			return l, d.catalog.Lists.Delete(l.ID)
+		})))
+
+		// Get all first issues from this reading list
+		router.GET("/api/lists/:listid/comics", liveJsonHandle(func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+			l, err := d.catalog.Lists.Get(p.ByName("listid"))
+			if err != nil || l.IsEmpty() {
+				return l, err
+			}
+			return service.ResolveReadingList(l, d.comics, d.groups), nil
+		}))
+	}
+
+	// Get co-appearance graph of characters, and creators if 'creators' is true
+	// Same filters as '/api/comics', 'format' is json, graphml or gexf
+	router.GET("/api/graph", graphHandle)
+
+	// Export reading order as CSV, Markdown or printable HTML
+	// Optional 'format' parameter, CSV by default
+	router.GET("/api/export/:type", exportHandle)
+	router.GET("/api/export/:type/:id", exportHandle)
+
 	// WEB
 
 	// Index -> Get all first issues from all phases
-	router.GET("/", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		updateMenu(&menu, r)
-		return getIndexPage(menu)
+	router.GET("/", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		v := newView(d, r)
+		return d.catalog.pages.getIndexPage(v, service.NextToRead(v.Progress, d.comics, service.NextQuery{Essentials: v.IsEssentials}))
 	}))
 
 	// Issues -> Get all first issues from this phases
-	router.GET("/phases/:id", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		issues, err := service.FindFirstIssuesByID(j["fissues-phases"], p.ByName("id"))
+	router.GET("/phases/:id", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		issues, err := service.FindFirstIssuesByID(d.json["fissues-phases"], p.ByName("id"))
 		if err != nil {
 			return "", err
 		}
-		updateMenu(&menu, r)
-		return getPhasesFissuesPage(menu, issues)
+		return d.catalog.pages.getPhasesFissuesPage(newView(d, r), issues)
 	}))
 
 	// Issues -> Get all issues from this comic from this phase
-	router.GET("/phases/:id/issues/:sortid", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		issues, err := service.ListComicsBySortID(j[fmt.Sprintf("comics-phase-%s", p.ByName("id"))], p.ByName("sortid"))
+	router.GET("/phases/:id/issues/:sortid", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		phase, exists := d.json[fmt.Sprintf("comics-phase-%s", p.ByName("id"))]
+		if !exists {
+			return "", notFound("Phase '%s' not found", p.ByName("id"))
+		}
+		issues, err := service.ListComicsBySortID(phase, p.ByName("sortid"))
 		if err != nil {
 			return "", err
 		}
-		updateMenu(&menu, r)
-		return getIssuesPage(menu, issues)
+		return d.catalog.pages.getIssuesPage(newView(d, r), issues)
 	}))
 
 	// Issues -> Get all first issues from this event
-	router.GET("/events/:id", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		issues, err := service.FindFirstIssuesByID(j["fissues-events"], p.ByName("id"))
+	router.GET("/events/:id", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		issues, err := service.FindFirstIssuesByID(d.json["fissues-events"], p.ByName("id"))
 		if err != nil {
 			return "", err
 		}
-		updateMenu(&menu, r)
-		return getEventsFissuesPage(menu, issues)
+		return d.catalog.pages.getEventsFissuesPage(newView(d, r), issues)
 	}))
 
 	// Issues -> Get all first issues from this character
-	router.GET("/characters/:id", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		issues, err := service.FindFirstIssuesByID(j["fissues-characters"], p.ByName("id"))
+	router.GET("/characters/:id", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		issues, err := service.FindFirstIssuesByID(d.json["fissues-characters"], p.ByName("id"))
 		if err != nil {
 			return "", err
 		}
-		updateMenu(&menu, r)
-		return getCharactersFissuesPage(menu, issues)
+		return d.catalog.pages.getCharactersFissuesPage(newView(d, r), issues)
 	}))
 
 	// Creators -> Get all creators
-	router.GET("/creators", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		creators, err := service.ListNamables(j["creators"])
+	router.GET("/creators", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		creators, err := service.ListNamables(d.json["creators"])
 		if err != nil {
 			return "", err
 		}
-		updateMenu(&menu, r)
-		return getCreatorsPage(menu, creators), nil
+		return d.catalog.pages.getCreatorsPage(newView(d, r), creators)
 	}))
 
 	// Issues -> Get all first issues from this creator
-	router.GET("/creators/:id", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		issues, err := service.FindFirstIssuesByID(j["fissues-creators"], p.ByName("id"))
+	router.GET("/creators/:id", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		issues, err := service.FindFirstIssuesByID(d.json["fissues-creators"], p.ByName("id"))
 		if err != nil {
 			return "", err
 		}
-		updateMenu(&menu, r)
-		return getCreatorsFissuesPage(menu, issues)
+		return d.catalog.pages.getCreatorsFissuesPage(newView(d, r), issues)
+	}))
+
+	if cfg.Lists != nil {
+		// Lists -> Get all reading lists
+		router.GET("/lists", liveWebHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+			all, err := d.catalog.Lists.List()
+			if err != nil {
+				return "", err
+			}
+			return d.catalog.pages.getListsPage(newView(d, r), all)
+		}))
+
+		// Issues -> Get all first issues from this reading list
+		router.GET("/lists/:listid", liveWebHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+			l, err := d.catalog.Lists.Get(p.ByName("listid"))
+			if err != nil {
+				return "", err
+			}
+			if l.IsEmpty() {
+				return "", notFound("List '%s' not found", p.ByName("listid"))
+			}
+			return d.catalog.pages.getListFissuesPage(newView(d, r), service.ResolveReadingList(l, d.comics, d.groups))
+		}))
+	}
+
+	// Stats -> Get issue counts per phase, event, character, creator and year
+	router.GET("/stats", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		v := newView(d, r)
+		q, err := service.NewStatsQuery(r.URL.Query())
+		if err != nil {
+			return "", badRequest("%v", err)
+		}
+		q.Essentials = v.IsEssentials
+		return d.catalog.pages.getStatsPage(v, service.GetStats(d.comics, q))
+	}))
+
+	// Timeline -> Get comics by publication month
+	router.GET("/timeline", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		v := newView(d, r)
+		q, err := service.NewTimelineQuery(r.URL.Query())
+		if err != nil {
+			return "", badRequest("%v", err)
+		}
+		if v.IsEssentials {
+			essential := true
+			q.Essential = &essential
+		}
+		return d.catalog.pages.getTimelinePage(v, service.GetTimeline(d.comics, q), q.OutOfOrder)
+	}))
+
+	// Search -> Get all results for this query
+	router.GET("/search", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		return d.catalog.pages.getSearchPage(newView(d, r), d.index.Search(r.FormValue("q")))
 	}))
 
 	// About
-	router.GET("/about", webHandle(func(r *http.Request, p httprouter.Params) (string, error) {
-		updateMenu(&menu, r)
-		return getAboutPage(menu), nil
+	router.GET("/about", webHandle(func(d *dataset, r *http.Request, p httprouter.Params) (string, error) {
+		return d.catalog.pages.getAboutPage(newView(d, r))
 	}))
 
-	http.Handle("/", router)
+	// Not found -> JSON for the API, HTML page otherwise
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := notFound("Resource '%s' not found", r.URL.Path)
+		if strings.HasPrefix(strings.TrimPrefix(r.URL.Path, catalogBase(r)), "/api/") {
+			writeJsonError(w, r, err)
+			return
+		}
+		writeResponse(w, r, nil, "", err)
+	})
+
+	return staticHandle(cfg, set, router), nil
 }
 
 // File readers
-func readJsonFiles() (jsonContent, error) {
-	m := make(jsonContent)
-	folder := "data"
+func readWebFiles(folder string) (*template.Template, error) {
+	m := template.New("")
 	files, err := ioutil.ReadDir(folder)
 	if err != nil {
-		return m, err
+		return m, fmt.Errorf("Cannot read folder '%s': %v", folder, err)
 	}
 	for _, f := range files {
 		split := strings.Split(f.Name(), ".")
-		if f.IsDir() || len(split) != 2 || split[1] != "json" {
-			break
+		if f.IsDir() || len(split) != 2 || split[1] != "html" {
+			continue
 		}
-		bytes, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", folder, f.Name()))
+		file := fmt.Sprintf("%s/%s", folder, f.Name())
+		bytes, err := ioutil.ReadFile(file)
 		if err != nil {
-			return m, err
+			return m, fmt.Errorf("Cannot read file '%s': %v", file, err)
 		}
-		json, err := jsonql.NewStringQuery(string(bytes))
+		_, err = m.New(f.Name()).Parse(string(bytes))
 		if err != nil {
-			return m, err
+			return m, fmt.Errorf("Cannot parse file '%s': %v", file, err)
 		}
-		m[split[0]] = json
 	}
 	return m, nil
 }
 
-func readWebFiles() (webContent, error) {
-	m := make(webContent)
-	folder := "html"
-	files, err := ioutil.ReadDir(folder)
+// First issues datasets for 't', or 'defaults' if empty
+func fissuesTypes(t string, defaults []string) ([]string, error) {
+	if t == "" {
+		return defaults, nil
+	}
+	for _, e := range fissuesAll {
+		if e == t {
+			return []string{t}, nil
+		}
+	}
+	return nil, badRequest("Invalid type '%s': must be one of %v", t, fissuesAll)
+}
+
+// Static files first, everything else to the router
+// Requests carry the catalogues of this handler
+func staticHandle(cfg Config, set *catalogSet, router http.Handler) http.Handler {
+	files := http.FileServer(http.Dir(cfg.StaticFolder))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withCatalogs(r, set)
+		if r.URL.Path == "/favicon.ico" && cfg.Favicon != "" {
+			http.ServeFile(w, r, cfg.Favicon)
+			return
+		}
+		if cfg.StaticFolder != "" && staticExtensions[strings.ToLower(path.Ext(r.URL.Path))] {
+			files.ServeHTTP(w, r)
+			return
+		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// Paginated lists
+func queryNamables(d *dataset, r *http.Request, namables *jsonql.JSONQL, related func(c *service.Comic) service.NamableList) (service.JsonAble, error) {
+	q, err := service.NewListQuery(r.URL.Query())
 	if err != nil {
-		return m, err
+		return nil, badRequest("%v", err)
 	}
-	for _, f := range files {
-		split := strings.Split(f.Name(), ".")
-		if f.IsDir() || len(split) != 2 || split[1] != "html" {
-			break
+	list, err := service.ListNamables(namables)
+	if err != nil {
+		return nil, err
+	}
+	page, err := service.QueryNamables(list, d.comics, related, q)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return withNext(r, page), nil
+}
+
+func withNext(r *http.Request, page *service.Page) service.JsonAble {
+	if page == nil {
+		return nil
+	}
+	if page.HasNext() {
+		v := r.URL.Query()
+		v.Set("offset", fmt.Sprintf("%v", page.Offset+page.Limit))
+		v.Set("limit", fmt.Sprintf("%v", page.Limit))
+		page.Next = fmt.Sprintf("%s?%s", r.URL.Path, v.Encode())
+	}
+	return page
+}
+
+// Reading progress
+// Reader comes from the 'reader' parameter, or the cookie set by web pages
+func readerName(r *http.Request) string {
+	reader := r.URL.Query().Get("reader")
+	if reader != "" {
+		return reader
+	}
+	cookie, err := r.Cookie("reader")
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func apiReader(r *http.Request) (string, error) {
+	reader := readerName(r)
+	if reader == "" {
+		return service.DefaultReader, nil
+	}
+	err := service.ValidateReader(reader)
+	if err != nil {
+		return "", badRequest("%v", err)
+	}
+	return reader, nil
+}
+
+func markRead(d *dataset, r *http.Request, comics service.ComicList, read bool) (service.JsonAble, error) {
+	reader, err := apiReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.catalog.Progress.Update(reader, func(p *service.Progress) {
+		p.Mark(comics, read)
+	})
+}
+
+// Keep '?reader=' for the next pages
+func rememberReader(w http.ResponseWriter, r *http.Request) {
+	reader := r.URL.Query().Get("reader")
+	if reader != "" && service.ValidateReader(reader) == nil {
+		http.SetCookie(w, &http.Cookie{Name: "reader", Value: reader, Path: "/", MaxAge: 365 * 24 * 3600})
+	}
+}
+
+// Export all comics, or first issues from this phase, event, character or creator
+func exportHandle(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	requestID(w, r)
+	err := validateParams(r, p)
+	if err != nil {
+		writeJsonError(w, r, err)
+		return
+	}
+	t, id := p.ByName("type"), p.ByName("id")
+	format := r.FormValue("format")
+	if format == "" {
+		format = service.ExportCSV
+	}
+	err = service.ValidateExportFormat(format)
+	if err == nil {
+		err = service.ValidateExportType(t)
+	}
+	if err == nil && t == service.ExportComics && id != "" {
+		err = fmt.Errorf("Export of '%s' takes no id", t)
+	}
+	if err == nil && t != service.ExportComics && id == "" {
+		err = fmt.Errorf("Export of '%s' needs an id", t)
+	}
+	if err != nil {
+		writeJsonError(w, r, badRequest("%v", err))
+		return
+	}
+
+	d := data(r)
+	var e *service.Export
+	name := t
+	if t == service.ExportComics {
+		all, err := service.ListAllComics(d.json["comics"])
+		if err != nil {
+			writeJsonError(w, r, err)
+			return
 		}
-		bytes, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", folder, f.Name()))
+		e = service.ExportComicList("Reading order", all)
+	} else {
+		fissues, err := service.FindFirstIssuesByID(d.json[fmt.Sprintf("fissues-%s", t)], id)
 		if err != nil {
-			return m, err
+			writeJsonError(w, r, err)
+			return
 		}
-		m[split[0]] = string(bytes)
+		if fissues.IsEmpty() {
+			writeJsonError(w, r, notFound("Resource '%s' not found", r.URL.Path))
+			return
+		}
+		e = service.ExportFissues(fissues)
+		name = fmt.Sprintf("%s-%s", t, id)
 	}
-	return m, nil
+	var b bytes.Buffer
+	err = e.Write(&b, format)
+	if err != nil {
+		writeJsonError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", service.ExportContentType(format))
+	if format != service.ExportHTML {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", name, service.ExportExtension(format)))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
+
+// Graph formats other than JSON are XML, so not a jsonHandle
+func graphHandle(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	requestID(w, r)
+	d := data(r)
+	if d.cache.serve(w, r) {
+		return
+	}
+	err := validateParams(r, p)
+	if err != nil {
+		writeJsonError(w, r, err)
+		return
+	}
+	q, err := service.NewGraphQuery(r.URL.Query())
+	if err != nil {
+		writeJsonError(w, r, badRequest("%v", err))
+		return
+	}
+	g := service.BuildGraph(d.comics, q)
+	if g.IsEmpty() {
+		writeJsonError(w, r, notFound("Resource '%s' not found", r.URL.Path))
+		return
+	}
+	var b bytes.Buffer
+	err = g.Write(&b, q.Format)
+	if err != nil {
+		writeJsonError(w, r, err)
+		return
+	}
+	d.cache.write(w, r, service.GraphContentType(q.Format), b.Bytes())
+}
+
+// Reading lists
+// Body is read as JSON, up to 1MB
+func readJson(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		return badRequest("Invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+func readList(d *dataset, r *http.Request, l *service.ReadingList) error {
+	err := readJson(r, l)
+	if err != nil {
+		return err
+	}
+	err = l.Validate(d.comics, d.groups)
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	return nil
 }
 
 // Handlers
+// Successful GET responses are cached until the dataset changes
 func jsonHandle(handle jsonHandler) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		result, err := handle(p)
-		writeJsonResponse(w, result, err)
+		requestID(w, r)
+		d := data(r)
+		if d.cache.serve(w, r) {
+			return
+		}
+		err := validateParams(r, p)
+		if err != nil {
+			writeJsonError(w, r, err)
+			return
+		}
+		result, err := handle(d, r, p)
+		writeJsonResponse(w, r, d.cache, result, err)
+	}
+}
+
+// Writes need the admin token when there is one
+// With no token they are open to anyone: for local use only
+func guarded(token string, handle jsonHandler) jsonHandler {
+	return func(d *dataset, r *http.Request, p httprouter.Params) (service.JsonAble, error) {
+		if token != "" && !authorized(r, token) {
+			return nil, unauthorized("Invalid admin token")
+		}
+		return handle(d, r, p)
+	}
+}
+
+// Never cached: health, admin, reading progress and lists
+func liveJsonHandle(handle jsonHandler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		requestID(w, r)
+		err := validateParams(r, p)
+		if err != nil {
+			writeJsonError(w, r, err)
+			return
+		}
+		result, err := handle(data(r), r, p)
+		writeJsonResponse(w, r, nil, result, err)
 	}
 }
 
 func webHandle(handle webHandler) httprouter.Handle {
+	return webHandleCache(handle, true)
+}
+
+// Never cached: reading lists
+func liveWebHandle(handle webHandler) httprouter.Handle {
+	return webHandleCache(handle, false)
+}
+
+func webHandleCache(handle webHandler, cached bool) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		result, err := handle(r, p)
-		writeResponse(w, result, err)
+		requestID(w, r)
+		d := data(r)
+		c := d.cache
+		if d.catalog.Progress != nil && readerName(r) != "" {
+			// Read state changes without the data changing
+			rememberReader(w, r)
+			c = nil
+		}
+		if !cached {
+			c = nil
+		}
+		if c.serve(w, r) {
+			return
+		}
+		err := validateParams(r, p)
+		if err != nil {
+			writeResponse(w, r, nil, "", err)
+			return
+		}
+		result, err := handle(d, r, p)
+		writeResponse(w, r, c, result, err)
+	}
+}
+
+func validateParams(r *http.Request, p httprouter.Params) error {
+	for _, e := range p {
+		switch e.Key {
+		case "catalog":
+			if _, exists := catalogsOf(r).byName[e.Value]; !exists {
+				return notFound("Catalogue '%s' not found", e.Value)
+			}
+		case "id", "sortid":
+			err := validateCode(e.Key, e.Value)
+			if err != nil {
+				return err
+			}
+		case "comicid":
+			err := validateComicID(e.Value)
+			if err != nil {
+				return err
+			}
+		case "listid":
+			err := service.ValidateListID(e.Value)
+			if err != nil {
+				return badRequest("%v", err)
+			}
+		}
 	}
+	return nil
 }
 
 // Response Writers
-func writeJsonResponse(w http.ResponseWriter, j service.JsonAble, err error) {
+func writeJsonResponse(w http.ResponseWriter, r *http.Request, c *pageCache, j service.JsonAble, err error) {
 	if err != nil {
-		writeError(w, err)
+		writeJsonError(w, r, err)
 		return
 	}
 	if j.IsEmpty() {
-		w.WriteHeader(http.StatusNotFound)
+		writeJsonError(w, r, notFound("Resource '%s' not found", r.URL.Path))
 		return
 	}
 	bytes, err := j.ToJson()
 	if err != nil {
-		writeError(w, err)
+		writeJsonError(w, r, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes)
+	c.write(w, r, "application/json", bytes)
 }
 
-func writeResponse(w http.ResponseWriter, s string, err error) {
-	if err != nil {
-		writeError(w, err)
+func writeResponse(w http.ResponseWriter, r *http.Request, c *pageCache, s string, err error) {
+	if err == nil {
+		c.write(w, r, "text/html", []byte(s))
 		return
 	}
+	code := errorCode(err)
+	d := data(r)
+	v := newView(d, r)
+	message := err.Error()
+	if code == http.StatusInternalServerError {
+		// Don't leak internals
+		log.Printf("[Error] %s %s (%s): %v", r.Method, r.URL.Path, requestID(w, r), err)
+		message = http.StatusText(code)
+	}
+	var errPage error
+	if code == http.StatusNotFound {
+		s, errPage = d.catalog.pages.getNotFoundPage(v)
+	} else {
+		s, errPage = d.catalog.pages.getErrorPage(v, code, message, requestID(w, r))
+	}
+	if errPage != nil {
+		log.Printf("[Error] Cannot render error page: %v", errPage)
+		s = html.EscapeString(message)
+	}
 	bytes := []byte(s)
 	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 	w.Write(bytes)
 }
 
-func writeError(w http.ResponseWriter, err error) {
-	w.Header().Set("Error", err.Error())
-	w.WriteHeader(http.StatusInternalServerError)
-}
-
 // Util
-func updateMenu(menu *service.Menu, r *http.Request) {
-	menu.URI = r.URL.Path
-	menu.IsEssentials = r.FormValue("essentials") == "true"
+func newView(d *dataset, r *http.Request) service.View {
+	v := service.View{
+		Menu:         d.menu,
+		URI:          r.URL.Path,
+		IsEssentials: r.FormValue("essentials") == "true",
+		Groups:       d.groups,
+		Catalog:      d.catalog.Name,
+		Catalogs:     catalogsOf(r).list,
+		Base:         catalogBase(r),
+	}
+	reader := readerName(r)
+	if d.catalog.Progress != nil && reader != "" && service.ValidateReader(reader) == nil {
+		read, err := d.catalog.Progress.Get(reader)
+		if err != nil {
+			log.Printf("[Error] Cannot get progress for '%s': %v", reader, err)
+		}
+		v.Progress = read
+	}
+	return v
 }
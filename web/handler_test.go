@@ -0,0 +1,280 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/adriwankenobi/comic/service"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testHandler http.Handler
+var testHandlerOnce sync.Once
+
+// Handler over the real data and html folders, also served as a second catalogue
+func newTestHandler(t *testing.T) http.Handler {
+	testHandlerOnce.Do(func() {
+		h, err := NewHandler(Config{DataFolder: "data", WebFolder: "html", Catalogs: []Catalog{
+			{Name: "copy", Title: "Copy", DataFolder: "data"},
+		}})
+		if err != nil {
+			t.Fatalf("Cannot load test data: %v", err)
+		}
+		testHandler = h
+	})
+	if testHandler == nil {
+		t.Fatal("Test handler not loaded")
+	}
+	return testHandler
+}
+
+func testPhases(t *testing.T, h http.Handler) service.NamableList {
+	phases := service.NamableList{}
+	err := json.Unmarshal(get(h, "/api/phases").Body.Bytes(), &phases)
+	if err != nil || len(phases) == 0 {
+		t.Fatalf("Cannot read phases: %v", err)
+	}
+	return phases
+}
+
+func get(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+// Each response must keep its own path and essentials toggle
+// Run with -race
+func TestConcurrentEssentials(t *testing.T) {
+	h := newTestHandler(t)
+	phases := testPhases(t, h)
+	var wg sync.WaitGroup
+	errs := make(chan error, len(phases)*4)
+	for i := 0; i < 4; i++ {
+		for k, p := range phases {
+			wg.Add(1)
+			essentials := (i+k)%2 == 0
+			go func(id string, essentials bool) {
+				defer wg.Done()
+				errs <- checkEssentials(h, id, essentials)
+			}(p.ID, essentials)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func checkEssentials(h http.Handler, id string, essentials bool) error {
+	uri := fmt.Sprintf("/phases/%s", id)
+	path := uri
+	toggle := fmt.Sprintf(`<li class=""><a href="%s?essentials=true">Only Essentials</a></li>`, uri)
+	if essentials {
+		path = fmt.Sprintf("%s?essentials=true", uri)
+		toggle = fmt.Sprintf(`<li class="active"><a href="%s">Only Essentials</a></li>`, uri)
+	}
+	w := get(h, path)
+	if w.Code != http.StatusOK {
+		return fmt.Errorf("%s: expected status 200, got %v", path, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, toggle) {
+		return fmt.Errorf("%s: essentials toggle not found, expected %s", path, toggle)
+	}
+	// Essentials pages only link to essentials pages, and the other way round
+	if strings.Contains(body, `?essentials=true">Home`) != essentials {
+		return fmt.Errorf("%s: home link does not match essentials=%v", path, essentials)
+	}
+	return nil
+}
+
+// Pages of a catalogue only link within it
+func TestCatalogs(t *testing.T) {
+	h := newTestHandler(t)
+	id := testPhases(t, h)[0].ID
+	tests := []struct {
+		path     string
+		code     int
+		contains string
+	}{
+		{"/", http.StatusOK, `<li class="active"><a href="/">MARVEL</a></li>`},
+		{fmt.Sprintf("/phases/%s", id), http.StatusOK, fmt.Sprintf(`href="/phases/%s"`, id)},
+		{"/c/copy", http.StatusOK, `<li class="active"><a href="/c/copy">Copy</a></li>`},
+		{fmt.Sprintf("/c/copy/phases/%s", id), http.StatusOK, fmt.Sprintf(`href="/c/copy/phases/%s"`, id)},
+		{fmt.Sprintf("/c/copy/phases/%s?essentials=true", id), http.StatusOK, `action="/c/copy/search"`},
+		{"/c/copy/healthz", http.StatusOK, `"catalog": "copy"`},
+		{"/c/marvel/api/phases", http.StatusOK, fmt.Sprintf(`"id": "%s"`, id)},
+		{fmt.Sprintf("/c/missing/phases/%s", id), http.StatusNotFound, ""},
+		{"/c/missing/api/phases", http.StatusNotFound, "Catalogue 'missing' not found"},
+	}
+	for _, e := range tests {
+		w := get(h, e.path)
+		if w.Code != e.code {
+			t.Errorf("%s: expected status %v, got %v", e.path, e.code, w.Code)
+			continue
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, e.contains) {
+			t.Errorf("%s: expected %s", e.path, e.contains)
+		}
+		if strings.HasPrefix(e.path, "/c/copy/phases") && strings.Contains(body, `href="/phases/`) {
+			t.Errorf("%s: links out of the catalogue", e.path)
+		}
+	}
+}
+
+// Wrong parameters are the client's fault, with the reason
+func TestBadRequests(t *testing.T) {
+	h := newTestHandler(t)
+	tests := []struct {
+		path     string
+		contains string
+	}{
+		{"/api/comics?sort=bogus", "Invalid sort 'bogus'"},
+		{"/api/comics?sort=-bogus", "Invalid sort 'bogus'"},
+		{"/api/characters?sort=date", "Invalid sort 'date'"},
+		{"/api/comics?limit=0", "Invalid limit '0'"},
+		{"/api/events?essential=maybe", "Invalid essential 'maybe'"},
+	}
+	for _, e := range tests {
+		w := get(h, e.path)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %v", e.path, w.Code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), e.contains) {
+			t.Errorf("%s: expected %s", e.path, e.contains)
+		}
+	}
+}
+
+// Next page keeps the filters, JSON escapes its '&'
+func TestNextLinks(t *testing.T) {
+	h := newTestHandler(t)
+	tests := []struct {
+		path     string
+		contains string
+	}{
+		{"/api/comics?limit=2&essential=true", `"next": "/api/comics?essential=true\u0026limit=2\u0026offset=2"`},
+		{"/c/copy/api/characters?limit=1&offset=3", `"next": "/c/copy/api/characters?limit=1\u0026offset=4"`},
+	}
+	for _, e := range tests {
+		w := get(h, e.path)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %v", e.path, w.Code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), e.contains) {
+			t.Errorf("%s: expected %s", e.path, e.contains)
+		}
+	}
+	w := get(h, "/api/comics?offset=100000")
+	if strings.Contains(w.Body.String(), `"next"`) {
+		t.Error("Last page links to a next one")
+	}
+}
+
+// Handlers keep their own catalogues and templates
+func TestHandlersApart(t *testing.T) {
+	h := newTestHandler(t)
+	folder, err := ioutil.TempDir("", "html")
+	if err != nil {
+		t.Fatalf("Cannot create temporary folder: %v", err)
+	}
+	defer os.RemoveAll(folder)
+	files, _ := filepath.Glob("html/*.html")
+	for _, f := range files {
+		bytes, _ := ioutil.ReadFile(f)
+		if filepath.Base(f) == "about.html" {
+			bytes = []byte(`{{define "about"}}Other about{{end}}`)
+		}
+		ioutil.WriteFile(filepath.Join(folder, filepath.Base(f)), bytes, 0644)
+	}
+	other, err := NewHandler(Config{Name: "other", Title: "Other", DataFolder: "data", WebFolder: folder})
+	if err != nil {
+		t.Fatalf("Cannot load other handler: %v", err)
+	}
+	tests := []struct {
+		h        http.Handler
+		path     string
+		contains string
+		not      string
+	}{
+		{h, "/about", "The main purpose of the site", "Other about"},
+		{other, "/about", "Other about", "The main purpose of the site"},
+		{h, "/api/catalogs", `"id": "copy"`, `"id": "other"`},
+		{other, "/api/catalogs", `"id": "other"`, `"id": "copy"`},
+		{h, "/c/copy/about", "The main purpose of the site", "Other about"},
+		{other, "/c/copy/about", "", "The main purpose of the site"},
+	}
+	for i, e := range tests {
+		body := get(e.h, e.path).Body.String()
+		if !strings.Contains(body, e.contains) || strings.Contains(body, e.not) {
+			t.Errorf("%v %s: expected %s and not %s", i, e.path, e.contains, e.not)
+		}
+	}
+}
+
+// Progress and list writes need the admin token once there is one
+func TestGuardedWrites(t *testing.T) {
+	folder, err := ioutil.TempDir("", "progress")
+	if err != nil {
+		t.Fatalf("Cannot create temporary folder: %v", err)
+	}
+	defer os.RemoveAll(folder)
+	progress, err := service.NewFileProgressStore(filepath.Join(folder, "progress"))
+	if err != nil {
+		t.Fatalf("Cannot create progress store: %v", err)
+	}
+	lists, err := service.NewFileReadingListStore(filepath.Join(folder, "lists"))
+	if err != nil {
+		t.Fatalf("Cannot create list store: %v", err)
+	}
+	h, err := NewHandler(Config{DataFolder: "data", WebFolder: "html", AdminToken: "secret", Progress: progress, Lists: lists})
+	if err != nil {
+		t.Fatalf("Cannot load handler: %v", err)
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		token  string
+		code   int
+	}{
+		{"PUT", "/api/progress/comics/9298?reader=me", "", "", http.StatusUnauthorized},
+		{"PUT", "/api/progress/comics/9298?reader=me", "", "wrong", http.StatusUnauthorized},
+		{"DELETE", "/api/progress/comics/9298?reader=me", "", "", http.StatusUnauthorized},
+		{"PUT", "/api/progress/phases/001/issues/001?reader=me", "", "", http.StatusUnauthorized},
+		{"PUT", "/api/progress/comics/9298?reader=me", "", "secret", http.StatusOK},
+		{"DELETE", "/api/progress/comics/9298?reader=me", "", "secret", http.StatusOK},
+		{"GET", "/api/progress?reader=me", "", "", http.StatusOK},
+		{"POST", "/api/lists", `{"name": "Mine", "items": [{"comicid": "9298"}]}`, "", http.StatusUnauthorized},
+		{"POST", "/api/lists/import", "[]", "", http.StatusUnauthorized},
+		{"PUT", "/api/lists/mine", `{"name": "Mine", "items": [{"comicid": "9298"}]}`, "", http.StatusUnauthorized},
+		{"DELETE", "/api/lists/mine", "", "", http.StatusUnauthorized},
+		{"POST", "/api/lists", `{"name": "Mine", "items": [{"comicid": "9298"}]}`, "secret", http.StatusOK},
+		{"POST", "/api/lists/import", "[]", "secret", http.StatusOK},
+		{"GET", "/api/lists", "", "", http.StatusOK},
+	}
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, e.path, strings.NewReader(e.body))
+		if e.token != "" {
+			req.Header.Set("Authorization", "Bearer "+e.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != e.code {
+			t.Errorf("%s %s with '%s': expected %v, got %v", e.method, e.path, e.token, e.code, w.Code)
+		}
+	}
+}
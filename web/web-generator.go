@@ -1,239 +1,523 @@
 package web
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/adriwankenobi/comic/service"
+	"html/template"
+	"net/http"
 	"sort"
 	"strings"
+	"time"
 )
 
+// Pages rendered from the templates of one handler
+type pages struct {
+	templates *template.Template
+}
+
+// View models
+
+// Link in menus and lists
+type linkView struct {
+	Link  string
+	Title string
+}
+
+// Layout around every page
+type layoutView struct {
+	Home         string
+	Creators     string
+	Lists        string
+	Stats        string
+	Timeline     string
+	Essentials   string
+	About        string
+	Search       string
+	IsEssentials bool
+	Active       []string
+	Catalogs     []catalogView // Only when there are several
+	Characters   [][]linkView
+	Phases       [][]linkView
+	Events       [][]linkView
+	Content      template.HTML
+}
+
+// Catalogue switcher
+type catalogView struct {
+	Link   string
+	Title  string
+	Active string
+}
+
+// Title and body of most pages
+type contentView struct {
+	Title string
+	Body  template.HTML
+}
+
+// One comic
+type issueView struct {
+	Name       string
+	Link       string
+	Pic        string
+	Collection string
+	Vol        int
+	Num        float64
+	Date       string
+	Universe   string
+	PhaseLink  string
+	PhaseName  string
+	EventLink  string
+	Event      string
+	Essential  string
+	Tracked    bool
+	Read       bool
+	Characters []linkView
+	Creators   []linkView
+	Comments   []string
+}
+
+type issuesView struct {
+	Home   string
+	Link   string
+	Title  string
+	Issues []issueView
+}
+
+// First issue card
+type fissueView struct {
+	Link            string
+	Pic             string
+	Title           string
+	Year            string
+	ProtagonistLink string
+	Protagonist     string
+	Ranges          []string
+	Notes           string
+	Tracked         bool
+	Read            int
+	Total           int
+}
+
+// Next to read card
+type nextView struct {
+	Title string
+	Card  fissueView
+}
+
+// Statistics tables
+type statsView struct {
+	service.Stats
+	Sections []statsSectionView
+}
+
+type statsSectionView struct {
+	Title  string
+	Column string
+	Rows   []statsRowView
+}
+
+type statsRowView struct {
+	service.StatsCount
+	Link string
+	Bar  int // Width, relative to the biggest row
+}
+
+// Issues by publication month
+type timelineView struct {
+	service.Timeline
+	From          string
+	To            string
+	OutOfOrderURL string // Only out of order issues, empty when already there
+	MonthViews    []timelineMonthView
+}
+
+type timelineMonthView struct {
+	Name   string
+	Issues []timelineIssueView
+}
+
+type timelineIssueView struct {
+	service.TimelineIssue
+	Link      string
+	PhaseLink string
+	EventLink string
+}
+
+type errorView struct {
+	Code      int
+	Status    string
+	Message   string
+	RequestID string
+}
+
 // Index
-func getIndexPage(menu service.Menu) (string, error) {
-	return getTemplate(c["intro"], menu, 0), nil
+func (pg *pages) getIndexPage(menu service.View, next *service.Next) (string, error) {
+	var view *nextView
+	if next != nil && next.Comic != nil {
+		c := next.Comic
+		view = &nextView{Title: "Start here", Card: fissueView{
+			Link:    essentialsLink(menu, fmt.Sprintf("/phases/%s/issues/%s", c.PhaseID, c.SortID)),
+			Pic:     c.Pic,
+			Title:   c.Title,
+			Year:    year(c.Date),
+			Ranges:  []string{fmt.Sprintf("%s vol. %v #%v", c.Collection, c.Vol, c.Num)},
+			Tracked: menu.Progress != nil,
+			Read:    next.Read,
+			Total:   next.Total,
+		}}
+		if next.Read > 0 {
+			view.Title = "Next to read"
+		}
+		if p, found := protagonist(menu, c); found {
+			view.Card.ProtagonistLink = essentialsLink(menu, fmt.Sprintf("/characters/%s", p.ID))
+			view.Card.Protagonist = p.Name
+		}
+	}
+	content, err := pg.render("intro", view)
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, 0)
 }
 
 // Issues
-func getIssuesPage(menu service.Menu, issues *service.ComicList) (string, error) {
+func (pg *pages) getIssuesPage(menu service.View, issues *service.ComicList) (string, error) {
 	if issues.IsEmpty() {
-		return getNotFoundPage(menu), nil
+		return "", notFound("Issues not found")
 	}
 
-	issuesContent := ""
+	view := issuesView{
+		Home:  catalogLink(menu, "/"),
+		Link:  essentialsLink(menu, fmt.Sprintf("/phases/%s/issues/%s", (*issues)[0].PhaseID, (*issues)[0].SortID)),
+		Title: (*issues)[0].Title,
+	}
 	for _, e := range *issues {
 		name := fmt.Sprintf("%s vol. %v #%v", e.Collection, e.Vol, e.Num)
 		essential := "NO"
 		if e.Essential {
 			essential = "YES"
 		}
-		characters := []string{}
-		for _, ch := range e.Characters {
-			link := fmt.Sprintf("/characters/%s", ch.ID)
-			if menu.IsEssentials {
-				link = fmt.Sprintf("%s?essentials=true", link)
-			}
-			char := fmt.Sprintf(c["a-link"], link, ch.Name)
-			characters = append(characters, char)
-		}
-		creators := []string{}
-		for _, cr := range e.Creators {
-			link := fmt.Sprintf("/creators/%s", cr.ID)
-			if menu.IsEssentials {
-				link = fmt.Sprintf("%s?essentials=true", link)
-			}
-			creat := fmt.Sprintf(c["a-link"], link, cr.Name)
-			creators = append(creators, creat)
-		}
-		displayEvent := "block"
-		if e.Event == "" {
-			displayEvent = "none"
+		issue := issueView{
+			Name:       name,
+			Link:       essentialsLink(menu, fmt.Sprintf("/phases/%s/issues/%s", e.PhaseID, e.SortID)),
+			Pic:        e.Pic,
+			Collection: e.Collection,
+			Vol:        e.Vol,
+			Num:        e.Num,
+			Date:       e.Date,
+			Universe:   e.Universe,
+			PhaseLink:  essentialsLink(menu, fmt.Sprintf("/phases/%s", e.PhaseID)),
+			PhaseName:  e.PhaseName,
+			EventLink:  essentialsLink(menu, fmt.Sprintf("/events/%s", e.EventID)),
+			Event:      e.Event,
+			Essential:  essential,
+			Tracked:    menu.Progress != nil,
+			Read:       menu.Progress.IsRead(e.ID),
+			Characters: getLinks(e.Characters, menu, "characters"),
+			Creators:   getLinks(e.Creators, menu, "creators"),
 		}
-		displayComments := "block"
-		if len(e.Comments) <= 0 {
-			displayComments = "none"
-		}
-		commentList := ""
-		for _, e := range e.Comments {
-			comment := fmt.Sprintf(c["list"], strings.Trim(e, " "))
-			commentList = fmt.Sprintf("%s%s", commentList, comment)
-		}
-
-		link := fmt.Sprintf("/phases/%s/issues/%s", e.PhaseID, e.SortID)
-		if menu.IsEssentials {
-			link = fmt.Sprintf("%s?essentials=true", link)
-		}
-	
-		phaseLink := fmt.Sprintf("/phases/%s", e.PhaseID)
-		if menu.IsEssentials {
-			phaseLink = fmt.Sprintf("%s?essentials=true", phaseLink)
-		}
-		
-		eventLink := fmt.Sprintf("/events/%s", e.EventID)
-		if menu.IsEssentials {
-			eventLink = fmt.Sprintf("%s?essentials=true", eventLink)
+		for _, co := range e.Comments {
+			issue.Comments = append(issue.Comments, strings.Trim(co, " "))
 		}
-		
-		con := fmt.Sprintf(c["content-issue"], name, link, e.Pic, name,
-			e.Collection,
-			e.Vol,
-			e.Num,
-			e.Date,
-			e.Universe,
-			phaseLink,
-			e.PhaseName,
-			displayEvent,
-			eventLink,
-			e.Event,
-			essential,
-			strings.Join(characters, ", "),
-			strings.Join(creators, ", "),
-			displayComments,
-			commentList,
-		)
-		issuesContent = fmt.Sprintf("%s%s", issuesContent, con)
-	}
-	issuesContent = fmt.Sprintf("%s%s", issuesContent, c["clear-fix"])
-	link := fmt.Sprintf("/phases/%s/issues/%s", (*issues)[0].PhaseID, (*issues)[0].SortID)
-	if menu.IsEssentials {
-		link = fmt.Sprintf("%s?essentials=true", link)
+		view.Issues = append(view.Issues, issue)
+	}
+	content, err := pg.render("content-issues", view)
+	if err != nil {
+		return "", err
 	}
-	content := fmt.Sprintf(c["content-issues"], link, (*issues)[0].Title, issuesContent)
-	return getTemplate(content, menu, -1), nil
+	return pg.getTemplate(content, menu, -1)
 }
 
 // Fissues
-func getCharactersFissuesPage(menu service.Menu, fissues *service.Fissues) (string, error) {
-	return getFissuesPage(menu, fissues, 1)
+func (pg *pages) getCharactersFissuesPage(menu service.View, fissues *service.Fissues) (string, error) {
+	return pg.getFissuesPage(menu, fissues, 1)
+}
+
+func (pg *pages) getPhasesFissuesPage(menu service.View, fissues *service.Fissues) (string, error) {
+	return pg.getFissuesPage(menu, fissues, 2)
 }
 
-func getPhasesFissuesPage(menu service.Menu, fissues *service.Fissues) (string, error) {
-	return getFissuesPage(menu, fissues, 2)
+func (pg *pages) getEventsFissuesPage(menu service.View, fissues *service.Fissues) (string, error) {
+	return pg.getFissuesPage(menu, fissues, 3)
 }
 
-func getEventsFissuesPage(menu service.Menu, fissues *service.Fissues) (string, error) {
-	return getFissuesPage(menu, fissues, 3)
+func (pg *pages) getCreatorsFissuesPage(menu service.View, fissues *service.Fissues) (string, error) {
+	return pg.getFissuesPage(menu, fissues, 4)
 }
 
-func getCreatorsFissuesPage(menu service.Menu, fissues *service.Fissues) (string, error) {
-	return getFissuesPage(menu, fissues, 4)
+func (pg *pages) getListFissuesPage(menu service.View, fissues *service.Fissues) (string, error) {
+	return pg.getFissuesPage(menu, fissues, 7)
 }
 
-func getFissuesPage(menu service.Menu, fissues *service.Fissues, activeTab int) (string, error) {
+func (pg *pages) getFissuesPage(menu service.View, fissues *service.Fissues, activeTab int) (string, error) {
 	if fissues.IsEmpty() {
-		return getNotFoundPage(menu), nil
-	}
-
-	issues := (*fissues).List
-	//phaseID := fissues.Namable.ID
-	issuesContent := ""
-	for _, i := range issues {
-		comicList := ""
-		l := []string{}
-		m := map[string][]float64{}
-		for _, e := range i.ComicList {
-			name := fmt.Sprintf("%s vol. %v", e.Collection, e.Vol)
-			_, exists := m[name]
-			if !exists {
-				l = append(l, name)
-				m[name] = []float64{}
-			}
-			found := false
-			for _, n := range m[name] {
-				if e.Num == n {
-					found = true
-					break
-				}
-			}
-			if !found {
-				m[name] = append(m[name], e.Num)
-			}
+		return "", notFound("Issues not found")
+	}
+
+	cards := []fissueView{}
+	for _, i := range fissues.List {
+		if menu.IsEssentials && !i.Essential {
+			continue
 		}
-		for _, k := range l {
-			v := m[k]
-			sort.Float64s(v)
-			name := fmt.Sprintf("%s #%v", k, v[0])
-			if len(v) > 1 {
-				for i := 1; i < len(v); i++ {
-					if v[i] > v[i-1]+1 {
-						name = fmt.Sprintf("%s - #%v", name, v[i-1])
-						h6 := fmt.Sprintf(c["h6"], name)
-						comicList = fmt.Sprintf("%s%s", comicList, h6)
-						name = fmt.Sprintf("%s #%v", k, v[i])
-					}
-				}
-				name = fmt.Sprintf("%s - #%v", name, v[len(v)-1])
-			}
-			h6 := fmt.Sprintf(c["h6"], name)
-			comicList = fmt.Sprintf("%s%s", comicList, h6)
+		read, total := menu.Progress.Count(menu.Groups.Get(i.PhaseID, i.SortID))
+		card := fissueView{
+			Link:    essentialsLink(menu, fmt.Sprintf("/phases/%s/issues/%s", i.PhaseID, i.SortID)),
+			Pic:     i.Pic,
+			Title:   i.Title,
+			Year:    year(i.Date),
+			Ranges:  service.GetIssueRanges(i.ComicList).Strings(),
+			Notes:   strings.Join(i.Comments, " "),
+			Tracked: menu.Progress != nil,
+			Read:    read,
+			Total:   total,
 		}
+		// Reading lists carry every character of the issue, not only the protagonist
+		if p, found := protagonist(menu, &i); found {
+			card.ProtagonistLink = essentialsLink(menu, fmt.Sprintf("/characters/%s", p.ID))
+			card.Protagonist = p.Name
+		}
+		cards = append(cards, card)
+	}
+	body, err := pg.render("fissues", cards)
+	if err != nil {
+		return "", err
+	}
+	content, err := pg.render("content", contentView{Title: fissues.Namable.Name, Body: body})
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, activeTab)
+}
 
-		link := fmt.Sprintf("/phases/%s/issues/%s", i.PhaseID, i.SortID)
-		if menu.IsEssentials {
-			link = fmt.Sprintf("%s?essentials=true", link)
+// Creators
+func (pg *pages) getCreatorsPage(menu service.View, creators *service.NamableList) (string, error) {
+	sort.Sort(service.ByName(*creators))
+	body, err := pg.render("creators", getMenuList(*creators, menu, 8, "creators", false))
+	if err != nil {
+		return "", err
+	}
+	content, err := pg.render("content", contentView{Title: "Creators", Body: body})
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, 4)
+}
+
+// Lists
+func (pg *pages) getListsPage(menu service.View, lists *service.ReadingLists) (string, error) {
+	links := [][]linkView{{}}
+	for _, e := range *lists {
+		links[0] = append(links[0], linkView{Link: essentialsLink(menu, fmt.Sprintf("/lists/%s", e.ID)), Title: e.Name})
+	}
+	body, err := pg.render("creators", links)
+	if err != nil {
+		return "", err
+	}
+	content, err := pg.render("content", contentView{Title: "Reading lists", Body: body})
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, 7)
+}
+
+// Stats
+func (pg *pages) getStatsPage(menu service.View, stats *service.Stats) (string, error) {
+	view := statsView{Stats: *stats, Sections: []statsSectionView{
+		getStatsSection(menu, "Phases", "Phase", stats.Phases, "phases"),
+		getStatsSection(menu, "Events", "Event", stats.Events, "events"),
+		getStatsSection(menu, "Top characters", "Character", stats.Characters, "characters"),
+		getStatsSection(menu, "Top creators", "Creator", stats.Creators, "creators"),
+		getStatsSection(menu, "Publication years", "Year", stats.Years, ""),
+	}}
+	body, err := pg.render("stats", view)
+	if err != nil {
+		return "", err
+	}
+	content, err := pg.render("content", contentView{Title: "Stats", Body: body})
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, 8)
+}
+
+func getStatsSection(menu service.View, title, column string, counts []service.StatsCount, link string) statsSectionView {
+	max := 0
+	for _, e := range counts {
+		if e.Issues > max {
+			max = e.Issues
+		}
+	}
+	section := statsSectionView{Title: title, Column: column}
+	for _, e := range counts {
+		row := statsRowView{StatsCount: e, Bar: e.Issues * 100 / max}
+		if link != "" {
+			row.Link = essentialsLink(menu, fmt.Sprintf("/%s/%s", link, e.ID))
 		}
+		section.Rows = append(section.Rows, row)
+	}
+	return section
+}
 
-		protagonistLink := fmt.Sprintf("/characters/%s", i.Characters[0].ID)
+// Timeline
+func (pg *pages) getTimelinePage(menu service.View, timeline *service.Timeline, onlyOutOfOrder bool) (string, error) {
+	view := timelineView{Timeline: *timeline}
+	if !onlyOutOfOrder && timeline.OutOfOrder > 0 {
+		view.OutOfOrderURL = fmt.Sprintf("%s/timeline?out_of_order=true", menu.Base)
 		if menu.IsEssentials {
-			protagonistLink = fmt.Sprintf("%s?essentials=true", protagonistLink)
+			view.OutOfOrderURL = fmt.Sprintf("%s/timeline?essentials=true&out_of_order=true", menu.Base)
 		}
-
-		conIssue := fmt.Sprintf(c["content-fissue"], link, i.Pic, i.Title, i.Date[:4],
-			protagonistLink, i.Characters[0].Name, link, i.Title, comicList)
-		
-		if !menu.IsEssentials || i.Essential {
-			issuesContent = fmt.Sprintf("%s%s", issuesContent, conIssue)
+	}
+	for _, m := range timeline.Months {
+		month := timelineMonthView{Name: monthName(m.Month)}
+		for _, e := range m.Issues {
+			issue := timelineIssueView{
+				TimelineIssue: e,
+				Link:          essentialsLink(menu, fmt.Sprintf("/phases/%s/issues/%s", e.PhaseID, e.SortID)),
+				PhaseLink:     essentialsLink(menu, fmt.Sprintf("/phases/%s", e.PhaseID)),
+			}
+			if e.EventID != "" {
+				issue.EventLink = essentialsLink(menu, fmt.Sprintf("/events/%s", e.EventID))
+			}
+			month.Issues = append(month.Issues, issue)
 		}
+		view.MonthViews = append(view.MonthViews, month)
+	}
+	if n := len(view.MonthViews); n > 0 {
+		view.From, view.To = view.MonthViews[0].Name, view.MonthViews[n-1].Name
+	}
+	body, err := pg.render("timeline", view)
+	if err != nil {
+		return "", err
 	}
-	content := fmt.Sprintf(c["content"], fissues.Namable.Name, issuesContent)
-	return getTemplate(content, menu, activeTab), nil
+	content, err := pg.render("content", contentView{Title: "Timeline", Body: body})
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, 9)
 }
 
-// Creators
-func getCreatorsPage(menu service.Menu, creators *service.NamableList) string {
-	sort.Sort(service.ByName(*creators))
-	columns := ""
-	n := 8
-	for i := 0; i < n; i++ {
-		k := len(*creators) / n
-		first := i * k
-		last := first + k - 1
-		list := ""
-		for j := first; j <= last; j++ {
-			e := (*creators)[j]
-			link := fmt.Sprintf("/creators/%s", e.ID)
-			if menu.IsEssentials {
-				link = fmt.Sprintf("%s?essentials=true", link)
-			}
-			a := fmt.Sprintf(c["a-link"], link, e.Name)
-			li := fmt.Sprintf(c["list"], a)
-			list = fmt.Sprintf("%s%s", list, li)
+// 'YYYY-MM' as 'May 2010'
+func monthName(month string) string {
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return month
+	}
+	return t.Format("January 2006")
+}
+
+// Search
+func (pg *pages) getSearchPage(menu service.View, search *service.Search) (string, error) {
+	results := []service.SearchResult{}
+	for _, e := range search.Results {
+		if menu.IsEssentials && e.Type == service.SearchComic && !e.Essential {
+			continue
 		}
-		ul := fmt.Sprintf(c["ul"], list)
-		column := fmt.Sprintf(c["div-left"], ul)
-		columns = fmt.Sprintf("%s%s", columns, column)
+		e.Link = essentialsLink(menu, e.Link)
+		if e.Type == service.SearchComic {
+			e.Name = fmt.Sprintf("%s (%s)", e.Name, e.Title)
+		}
+		results = append(results, e)
+	}
+	body, err := pg.render("search", results)
+	if err != nil {
+		return "", err
+	}
+	title := fmt.Sprintf("Search: %s", search.Query)
+	content, err := pg.render("content", contentView{Title: title, Body: body})
+	if err != nil {
+		return "", err
 	}
-	content := fmt.Sprintf(c["content"], "Creators", columns)
-	return getTemplate(content, menu, 4)
+	return pg.getTemplate(content, menu, -1)
 }
 
 // About
-func getAboutPage(menu service.Menu) string {
-	return getTemplate(c["about"], menu, 6)
+func (pg *pages) getAboutPage(menu service.View) (string, error) {
+	content, err := pg.render("about", nil)
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, 6)
 }
 
 // Not found
-func getNotFoundPage(menu service.Menu) string {
-	return getTemplate(c["not-found"], menu, -1)
+func (pg *pages) getNotFoundPage(menu service.View) (string, error) {
+	content, err := pg.render("not-found", nil)
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, -1)
+}
+
+// Error
+func (pg *pages) getErrorPage(menu service.View, code int, message, requestID string) (string, error) {
+	content, err := pg.render("error", errorView{code, http.StatusText(code), message, requestID})
+	if err != nil {
+		return "", err
+	}
+	return pg.getTemplate(content, menu, -1)
 }
 
 // Utils
+// Render named template, escaping everything in data
+func (pg *pages) render(name string, data interface{}) (template.HTML, error) {
+	var b bytes.Buffer
+	err := pg.templates.ExecuteTemplate(&b, name, data)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// Year from 'YYYY-MM-DD...'
+func year(date string) string {
+	if len(date) > 4 {
+		return date[:4]
+	}
+	return date
+}
+
+// Protagonist of the title of c, from its issues when the data has none, or c alone if not grouped
+func protagonist(menu service.View, c *service.Comic) (service.Namable, bool) {
+	if c.Protagonist != nil {
+		return *c.Protagonist, true
+	}
+	issues := menu.Groups.Get(c.PhaseID, c.SortID)
+	if len(issues) == 0 {
+		issues = service.ComicList{*c}
+	}
+	return service.GetProtagonist(c.Title, issues, "")
+}
+
+// Link within the catalogue of the page
+func catalogLink(menu service.View, link string) string {
+	if menu.Base == "" {
+		return link
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%s%s", menu.Base, link), "/")
+}
+
+func essentialsLink(menu service.View, link string) string {
+	link = catalogLink(menu, link)
+	if menu.IsEssentials {
+		return fmt.Sprintf("%s?essentials=true", link)
+	}
+	return link
+}
+
+func getLinks(namables service.NamableList, menu service.View, link string) []linkView {
+	return getMenuList(namables, menu, 1, link, false)[0]
+}
+
 // Menu
-func getMenuList(namables service.NamableList, isEssentials bool, n int, link string, showID bool) []string {
-	result := make([]string, n)
+func getMenuList(namables service.NamableList, menu service.View, n int, link string, showID bool) [][]linkView {
+	result := make([][]linkView, n)
 	m := len(namables) / n
 	r := len(namables) % n
 	start := 0
 	for i := 0; i < n; i++ {
-		list := ""
+		list := []linkView{}
 		end := start + m
 		if r != 0 {
 			end++
@@ -244,13 +528,8 @@ func getMenuList(namables service.NamableList, isEssentials bool, n int, link st
 			if showID {
 				title = fmt.Sprintf("%v - %s", j+1, title)
 			}
-			fullLink := fmt.Sprintf("/%s/%s", link, namables[j].ID)
-			if isEssentials {
-				fullLink = fmt.Sprintf("%s?essentials=true", fullLink)
-			}
-			alink := fmt.Sprintf(c["a-link"], fullLink, title)
-			li := fmt.Sprintf(c["list"], alink)
-			list = fmt.Sprintf("%s%s", list, li)
+			fullLink := essentialsLink(menu, fmt.Sprintf("/%s/%s", link, namables[j].ID))
+			list = append(list, linkView{Link: fullLink, Title: title})
 		}
 		result[i] = list
 		start = end
@@ -258,57 +537,45 @@ func getMenuList(namables service.NamableList, isEssentials bool, n int, link st
 	return result
 }
 
-func getTemplate(content string, menu service.Menu, activeTab int) string {
-	phasesMenu := getMenuList(*menu.Phases, menu.IsEssentials, 3, "phases", true)
-	eventsMenu := getMenuList(*menu.Events, menu.IsEssentials, 3, "events", false)
-	charactersMenu := getMenuList(*menu.Characters, menu.IsEssentials, 8, "characters", false)
-	tabs := 7
-	active := []string{}
-	for i := 0; i < tabs; i++ {
-		active = append(active, "")
+func (pg *pages) getTemplate(content template.HTML, menu service.View, activeTab int) (string, error) {
+	tabs := 10
+	layout := layoutView{
+		Home:         essentialsLink(menu, "/"),
+		Creators:     essentialsLink(menu, "/creators"),
+		Lists:        essentialsLink(menu, "/lists"),
+		Stats:        essentialsLink(menu, "/stats"),
+		Timeline:     essentialsLink(menu, "/timeline"),
+		Essentials:   menu.URI,
+		About:        essentialsLink(menu, "/about"),
+		Search:       catalogLink(menu, "/search"),
+		IsEssentials: menu.IsEssentials,
+		Active:       make([]string, tabs),
+		Characters:   getMenuList(*menu.Characters, menu, 8, "characters", false),
+		Phases:       getMenuList(*menu.Phases, menu, 3, "phases", true),
+		Events:       getMenuList(*menu.Events, menu, 3, "events", false),
+		Content:      content,
 	}
 	if activeTab >= 0 && activeTab < tabs {
-		active[activeTab] = "active"
+		layout.Active[activeTab] = "active"
 	}
-	main := "/"
-	creators := "/creators"
-	essentials := menu.URI
-	about := "/about"
 	if !menu.IsEssentials {
-		essentials = fmt.Sprintf("%s?essentials=true", essentials)
+		layout.Essentials = fmt.Sprintf("%s?essentials=true", layout.Essentials)
 	} else {
-		main = fmt.Sprintf("%s?essentials=true", main)
-		creators = fmt.Sprintf("%s?essentials=true", creators)
-		active[5] = "active"
-		about = fmt.Sprintf("%s?essentials=true", about)
-	}
-	return fmt.Sprintf(c["template"],
-		main,
-		active[0],
-		main,
-		active[1],
-		charactersMenu[0],
-		charactersMenu[1],
-		charactersMenu[2],
-		charactersMenu[3],
-		charactersMenu[4],
-		charactersMenu[5],
-		charactersMenu[6],
-		charactersMenu[7],
-		active[2],
-		phasesMenu[0],
-		phasesMenu[1],
-		phasesMenu[2],
-		active[3],
-		eventsMenu[0],
-		eventsMenu[1],
-		eventsMenu[2],
-		active[4],
-		creators,
-		active[5],
-		essentials,
-		active[6],
-		about,
-		content,
-	)
+		layout.Active[5] = "active"
+	}
+	// The first catalogue is served at '/', the others under '/c/<name>'
+	if len(menu.Catalogs) > 1 {
+		for i, e := range menu.Catalogs {
+			c := catalogView{Link: fmt.Sprintf("/c/%s", e.ID), Title: e.Name}
+			if i == 0 {
+				c.Link = "/"
+			}
+			if e.ID == menu.Catalog {
+				c.Active = "active"
+			}
+			layout.Catalogs = append(layout.Catalogs, c)
+		}
+	}
+	page, err := pg.render("template", layout)
+	return string(page), err
 }
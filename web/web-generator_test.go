@@ -0,0 +1,157 @@
+package web
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/adriwankenobi/comic/service"
+	"io/ioutil"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Update golden files in testdata")
+
+// Small menu, with names needing escaping
+func goldenView(isEssentials bool) service.View {
+	uri := "/"
+	if isEssentials {
+		uri = "/phases/001"
+	}
+	return service.View{
+		Menu: service.Menu{
+			Phases:     &service.NamableList{{ID: "001", Name: "Heroic Age"}, {ID: "002", Name: "Dark Reign"}},
+			Events:     &service.NamableList{{ID: "001", Name: "Siege"}},
+			Characters: &service.NamableList{{ID: "001", Name: "Spider-Man"}, {ID: "002", Name: "Eric O'Grady"}},
+		},
+		URI:          uri,
+		IsEssentials: isEssentials,
+		Groups:       service.GroupComics(goldenComics()),
+	}
+}
+
+func goldenComics() *service.ComicList {
+	return &service.ComicList{
+		{
+			ID: "1", Collection: "Amazing Spider-Man", Title: "Good Guys & Bad Guys", Vol: 1, Num: 1,
+			Date: "2010-01-01", Event: "Siege", EventID: "001", Pic: "http://example.com/1.jpg",
+			Characters: service.NamableList{{ID: "001", Name: "Spider-Man"}},
+			Creators:   service.NamableList{{ID: "001", Name: "Dan Slott"}},
+			Universe:   "616", Essential: true, PhaseID: "001", PhaseName: "Heroic Age", SortID: "001",
+			Comments: []string{" <script>alert('x')</script> ", "100% canon"},
+		},
+		{
+			ID: "2", Collection: "Amazing Spider-Man", Title: "Good Guys & Bad Guys", Vol: 1, Num: 2,
+			Date: "2010-02-01", Pic: "http://example.com/2.jpg",
+			Characters: service.NamableList{{ID: "001", Name: "Spider-Man"}},
+			Universe:   "616", PhaseID: "001", PhaseName: "Heroic Age", SortID: "001",
+		},
+	}
+}
+
+func goldenFissues() *service.Fissues {
+	comics := *goldenComics()
+	first := comics[0]
+	first.ComicList = append(comics, service.Comic{Collection: "Amazing Spider-Man", Vol: 1, Num: 5})
+	second := comics[1]
+	second.Title = "<b>Not essential</b>"
+	second.Essential = false
+	second.SortID = "002"
+	second.ComicList = service.ComicList{comics[1]}
+	return &service.Fissues{
+		Namable: service.Namable{ID: "001", Name: "Heroic Age"},
+		List:    service.ComicList{first, second},
+	}
+}
+
+// Each page must render exactly as its golden file
+// Run with -update to accept changes
+func TestGoldenPages(t *testing.T) {
+	pg := loadPages(t)
+	pages := []struct {
+		name string
+		page func() (string, error)
+	}{
+		{"index", func() (string, error) {
+			return pg.getIndexPage(goldenView(false), service.NextToRead(nil, goldenComics(), service.NextQuery{}))
+		}},
+		{"fissues", func() (string, error) { return pg.getPhasesFissuesPage(goldenView(false), goldenFissues()) }},
+		{"fissues-essentials", func() (string, error) { return pg.getPhasesFissuesPage(goldenView(true), goldenFissues()) }},
+		{"issues", func() (string, error) { return pg.getIssuesPage(goldenView(false), goldenComics()) }},
+		{"creators", func() (string, error) {
+			creators := service.NamableList{}
+			for i := 1; i <= 10; i++ {
+				creators = append(creators, service.Namable{ID: fmt.Sprintf("%03d", i), Name: fmt.Sprintf("Creator <%02d>", 11-i)})
+			}
+			return pg.getCreatorsPage(goldenView(false), &creators)
+		}},
+		{"stats", func() (string, error) {
+			return pg.getStatsPage(goldenView(false), service.GetStats(goldenComics(), service.StatsQuery{Top: service.DefaultStatsTop}))
+		}},
+		{"timeline", func() (string, error) {
+			comics := goldenComics()
+			(*comics)[0].Date = "2010-03-01"
+			return pg.getTimelinePage(goldenView(false), service.GetTimeline(comics, service.TimelineQuery{}), false)
+		}},
+		{"list", func() (string, error) {
+			// Protagonist of the title, not the first character of its first issue
+			comics := goldenComics()
+			(*comics)[0].Characters = service.NamableList{{ID: "002", Name: "Eric O'Grady"}, {ID: "001", Name: "Spider-Man"}}
+			view := goldenView(false)
+			view.Groups = service.GroupComics(comics)
+			l := &service.ReadingList{ID: "001", Name: "Spider-Man & friends", Items: []service.ReadingListItem{
+				{PhaseID: "001", SortID: "001", Notes: "Start here"},
+				{ComicID: "2"},
+			}}
+			return pg.getListFissuesPage(view, service.ResolveReadingList(l, comics, view.Groups))
+		}},
+		{"about", func() (string, error) { return pg.getAboutPage(goldenView(false)) }},
+		{"not-found", func() (string, error) { return pg.getNotFoundPage(goldenView(false)) }},
+	}
+	for _, p := range pages {
+		got, err := p.page()
+		if err != nil {
+			t.Errorf("%s: cannot render page: %v", p.name, err)
+			continue
+		}
+		file := fmt.Sprintf("testdata/%s.golden", p.name)
+		if *update {
+			err = ioutil.WriteFile(file, []byte(got), 0644)
+			if err != nil {
+				t.Fatalf("Cannot write '%s': %v", file, err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Cannot read '%s': %v", file, err)
+		}
+		if !bytes.Equal([]byte(got), want) {
+			t.Errorf("%s: page does not match '%s', run with -update if the change is expected", p.name, file)
+		}
+	}
+}
+
+// Nothing from the data reaches the page unescaped
+func TestPagesEscapeData(t *testing.T) {
+	pg := loadPages(t)
+	page, err := pg.getIssuesPage(goldenView(false), goldenComics())
+	if err != nil {
+		t.Fatalf("Cannot render page: %v", err)
+	}
+	for _, s := range []string{"<script>alert", "Good Guys & Bad Guys", "O'Grady"} {
+		if bytes.Contains([]byte(page), []byte(s)) {
+			t.Errorf("Found unescaped '%s'", s)
+		}
+	}
+	if !bytes.Contains([]byte(page), []byte("100% canon")) {
+		t.Error("Comment with '%' not rendered literally")
+	}
+}
+
+func loadPages(t *testing.T) *pages {
+	templates, err := readWebFiles("html")
+	if err != nil {
+		t.Fatalf("Cannot load templates: %v", err)
+	}
+	return &pages{templates: templates}
+}